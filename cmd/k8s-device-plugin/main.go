@@ -18,12 +18,20 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
 	"github.com/HAMi/mock-device-plugin/internal/pkg/api/device"
 	"github.com/HAMi/mock-device-plugin/internal/pkg/config"
+	"github.com/HAMi/mock-device-plugin/internal/pkg/server"
+	"github.com/HAMi/mock-device-plugin/internal/pkg/util/client"
+
+	"k8s.io/klog/v2"
 )
 
 var gitDescribe string
@@ -44,5 +52,45 @@ func main() {
 	config.GlobalFlagSet()
 	flag.Parse()
 	config.InitDevices()
-	device.RunManagers()
+	kubeClient, err := client.NewClient(client.Options{
+		Kubeconfig: config.Kubeconfig,
+		QPS:        float32(config.KubeAPIQPS),
+		Burst:      config.KubeAPIBurst,
+		UserAgent:  client.UserAgent(gitDescribe),
+	})
+	if err != nil {
+		klog.Fatalf("Failed to initialize Kubernetes client: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	// The servers outlive the managers, so that probes keep answering while they drain.
+	serverCtx, stopServers := context.WithCancel(context.Background())
+	var servers sync.WaitGroup
+	for _, serve := range []func(context.Context){
+		func(ctx context.Context) { server.ServeMetrics(ctx, config.MetricsBindAddress) },
+		func(ctx context.Context) { server.ServeProbes(ctx, config.HealthProbeBindAddress) },
+		func(ctx context.Context) { server.ServeAdmin(ctx, config.AdminBindAddress) },
+	} {
+		servers.Add(1)
+		go func(serve func(context.Context)) {
+			defer servers.Done()
+			serve(serverCtx)
+		}(serve)
+	}
+
+	err = device.RunManagers(ctx, kubeClient, device.ManagerOptions{
+		ShutdownTimeout:  config.ShutdownTimeout,
+		MaxStaleness:     config.MaxStaleness,
+		DevicePluginPath: config.DevicePluginPath,
+	})
+	stopServers()
+	servers.Wait()
+	if err != nil {
+		klog.ErrorS(err, "Failed to shut down cleanly")
+		klog.Flush()
+		os.Exit(1)
+	}
+	klog.Info("Shutdown complete")
+	klog.Flush()
 }
@@ -20,10 +20,10 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"sync"
 
 	"github.com/HAMi/mock-device-plugin/internal/pkg/api/device"
-	"github.com/HAMi/mock-device-plugin/internal/pkg/mock"
-	"github.com/kubevirt/device-plugin-manager/pkg/dpm"
+	"github.com/HAMi/mock-device-plugin/internal/pkg/metrics"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/klog/v2"
@@ -41,17 +41,28 @@ type VNPUConfig struct {
 	ChipName           string     `yaml:"chipName"`
 	ResourceName       string     `yaml:"resourceName"`
 	ResourceMemoryName string     `yaml:"resourceMemoryName"`
+	ResourceAICoreName string     `yaml:"resourceAICoreName"`
+	ResourceAICPUName  string     `yaml:"resourceAICPUName"`
 	MemoryAllocatable  int64      `yaml:"memoryAllocatable"`
 	MemoryCapacity     int64      `yaml:"memoryCapacity"`
 	MemoryFactor       int32      `yaml:"memoryFactor"`
 	AICore             int32      `yaml:"aiCore"`
 	AICPU              int32      `yaml:"aiCPU"`
 	Templates          []Template `yaml:"templates"`
+	// AdvertiseTemplates also publishes how many instances of each template could be
+	// carved from the registered NPUs, e.g. huawei.com/Ascend910B-vir02.
+	AdvertiseTemplates bool `yaml:"advertiseTemplates"`
+	// Reserved is kept back from every NPU before its memory and AI cores are advertised.
+	Reserved device.Reservation `yaml:"reserved"`
 }
 
 type Devices struct {
 	config           VNPUConfig
 	nodeRegisterAnno string
+	handshakeAnno    string
+	// mismatchedMemory remembers the devmem last reported as not matching the chip by
+	// device ID, so every mismatch is logged once rather than on every sync.
+	mismatchedMemory sync.Map
 }
 
 func InitDevices(config []VNPUConfig) []*Devices {
@@ -61,6 +72,7 @@ func InitDevices(config []VNPUConfig) []*Devices {
 		dev := &Devices{
 			config:           vnpu,
 			nodeRegisterAnno: fmt.Sprintf("hami.io/node-register-%s", commonWord),
+			handshakeAnno:    fmt.Sprintf("hami.io/node-handshake-%s", commonWord),
 		}
 		sort.Slice(dev.config.Templates, func(i, j int) bool {
 			return dev.config.Templates[i].Memory < dev.config.Templates[j].Memory
@@ -86,6 +98,7 @@ func (dev *Devices) GetNodeDevices(n *corev1.Node) ([]*device.DeviceInfo, error)
 	}
 	if err != nil {
 		klog.ErrorS(err, "failed to unmarshal node devices", "node", n.Name, "device annotation", anno)
+		metrics.DecodeFailures.WithLabelValues(dev.CommonWord()).Inc()
 		return []*device.DeviceInfo{}, err
 	}
 	if len(nodeDevices) == 0 {
@@ -97,20 +110,61 @@ func (dev *Devices) GetNodeDevices(n *corev1.Node) ([]*device.DeviceInfo, error)
 
 func (dev *Devices) GetResource(n *corev1.Node) map[string]int {
 	resourceName := device.GetResourceName(dev.config.ResourceMemoryName)
+	aiCoreName := device.GetResourceName(dev.config.ResourceAICoreName)
+	aiCPUName := device.GetResourceName(dev.config.ResourceAICPUName)
 	resourceMap := map[string]int{
 		resourceName: 0,
 	}
-	if !device.CheckHealthy(n, dev.config.ResourceName) {
+	if aiCoreName != "" {
+		resourceMap[aiCoreName] = 0
+	}
+	if aiCPUName != "" {
+		resourceMap[aiCPUName] = 0
+	}
+	device.RecordMemoryFactor(dev.CommonWord(), dev.config.MemoryFactor)
+	if !device.CheckHealthy(n, device.HealthTarget{
+		Vendor:            dev.CommonWord(),
+		ResourceCountName: dev.config.ResourceName,
+		HandshakeAnnos:    dev.handshakeAnno,
+	}) {
 		klog.Infof("device %s is unhealthy on this node", dev.CommonWord())
+		device.RecordReserved(dev.CommonWord(), nil)
 		return resourceMap
 	}
 	devInfos, err := dev.GetNodeDevices(n)
 	if err != nil || len(devInfos) == 0 {
 		klog.Infof("no device %s on this node", dev.config.CommonWord)
+		device.RecordReserved(dev.CommonWord(), nil)
 		return resourceMap
 	}
+	devInfos = device.UsableDevices(n, dev.CommonWord(), devInfos)
+	var reserved *device.ReservedTotals
+	if !dev.config.Reserved.IsZero() {
+		reserved = &device.ReservedTotals{}
+	}
 	for _, val := range devInfos {
-		resourceMap[resourceName] += int(val.Devmem)
+		memory, aiCore := dev.chipMemory(val), dev.chipAICore(val)
+		if reserved != nil {
+			reserved.Memory += dev.rawChipMemory(val) - memory
+			reserved.Cores += int64(dev.rawChipAICore(val) - aiCore)
+		}
+		resourceMap[resourceName] += int(memory)
+		if aiCoreName != "" {
+			resourceMap[aiCoreName] += int(aiCore)
+		}
+		if aiCPUName != "" {
+			resourceMap[aiCPUName] += int(dev.config.AICPU)
+		}
+	}
+	device.RecordReserved(dev.CommonWord(), reserved)
+	if dev.config.AdvertiseTemplates {
+		for _, template := range dev.config.Templates {
+			templateName := dev.templateResourceName(template)
+			for _, val := range devInfos {
+				resourceMap[templateName] += dev.templateSlots(val, template)
+			}
+			klog.InfoS("Add template resource", templateName, resourceMap[templateName])
+		}
 	}
 	if dev.config.MemoryFactor > 1 {
 		rawMemory := resourceMap[resourceName]
@@ -118,13 +172,83 @@ func (dev *Devices) GetResource(n *corev1.Node) map[string]int {
 		klog.InfoS("Update memory", "raw", rawMemory, "after", resourceMap[resourceName], "factor", dev.config.MemoryFactor)
 	}
 	klog.InfoS("Add resource", resourceName, resourceMap[resourceName])
+	if aiCoreName != "" || aiCPUName != "" {
+		klog.InfoS("Add compute resources", aiCoreName, resourceMap[aiCoreName], aiCPUName, resourceMap[aiCPUName])
+	}
 	return resourceMap
 }
 
-func (dev *Devices) RunManager() {
-	lmock := mock.NewMockLister(device.GetVendorName(dev.config.ResourceMemoryName))
-	go device.Register(lmock, dev)
-	mockmanager := dpm.NewManager(lmock)
-	klog.Infof("Running mocking dp: %s", dev.CommonWord())
-	mockmanager.Run()
+// templateResourceName returns the resource name a template is advertised under.
+func (dev *Devices) templateResourceName(template Template) string {
+	return device.SanitizeResourceName(dev.config.CommonWord + "-" + template.Name)
+}
+
+// templateSlots returns how many instances of template fit on one NPU when it is
+// carved with that template only, bounded by memory, AI cores and AI CPUs.
+func (dev *Devices) templateSlots(val *device.DeviceInfo, template Template) int {
+	if template.Memory <= 0 {
+		return 0
+	}
+	slots := dev.chipMemory(val) / template.Memory
+	aiCore := int64(dev.chipAICore(val))
+	if template.AICore > 0 && aiCore > 0 {
+		slots = min(slots, aiCore/int64(template.AICore))
+	}
+	if template.AICPU > 0 && dev.config.AICPU > 0 {
+		slots = min(slots, int64(dev.config.AICPU/template.AICPU))
+	}
+	return int(slots)
+}
+
+// chipMemory returns the memory HAMi can hand out from one NPU, i.e. rawChipMemory
+// less the configured reservation.
+func (dev *Devices) chipMemory(val *device.DeviceInfo) int64 {
+	memory := dev.rawChipMemory(val)
+	return memory - dev.config.Reserved.ReservedMemory(memory)
+}
+
+// rawChipMemory returns the annotation value clamped to MemoryAllocatable, since part
+// of HBM is reserved on chips like 910B. Values that match neither the configured
+// capacity nor the allocatable memory most likely come from a different chip and
+// are logged once per device and value.
+func (dev *Devices) rawChipMemory(val *device.DeviceInfo) int64 {
+	memory := int64(val.Devmem)
+	mismatch := dev.config.MemoryCapacity > 0 && memory != dev.config.MemoryCapacity && memory != dev.config.MemoryAllocatable
+	if !mismatch {
+		dev.mismatchedMemory.Delete(val.ID)
+	} else if prev, loaded := dev.mismatchedMemory.Swap(val.ID, memory); !loaded || prev.(int64) != memory {
+		klog.InfoS("NPU memory does not match configured chip", "device", val.ID, "chipName", dev.config.ChipName,
+			"devmem", memory, "memoryCapacity", dev.config.MemoryCapacity, "memoryAllocatable", dev.config.MemoryAllocatable)
+	}
+	if dev.config.MemoryAllocatable > 0 && memory > dev.config.MemoryAllocatable {
+		klog.V(4).InfoS("Clamp NPU memory to allocatable", "device", val.ID, "devmem", memory, "memoryAllocatable", dev.config.MemoryAllocatable)
+		memory = dev.config.MemoryAllocatable
+	}
+	return memory
+}
+
+// chipAICore returns the AI cores HAMi can hand out from one NPU, i.e. rawChipAICore
+// less the configured reservation.
+func (dev *Devices) chipAICore(val *device.DeviceInfo) int32 {
+	aiCore := dev.rawChipAICore(val)
+	return aiCore - int32(dev.config.Reserved.ReservedCores(int64(aiCore)))
+}
+
+// rawChipAICore returns the AI cores of one NPU, falling back to the core count from
+// the register annotation when the config does not declare it.
+func (dev *Devices) rawChipAICore(val *device.DeviceInfo) int32 {
+	if dev.config.AICore > 0 {
+		return dev.config.AICore
+	}
+	return val.Devcore
+}
+
+func (dev *Devices) ResourceNames() []string {
+	names := []string{dev.config.ResourceMemoryName, dev.config.ResourceAICoreName, dev.config.ResourceAICPUName}
+	if dev.config.AdvertiseTemplates {
+		for _, template := range dev.config.Templates {
+			names = append(names, dev.templateResourceName(template))
+		}
+	}
+	return device.QualifyResourceNames(device.GetVendorName(dev.config.ResourceMemoryName), names...)
 }
@@ -18,6 +18,8 @@ package ascend
 import (
 	"testing"
 
+	"github.com/HAMi/mock-device-plugin/internal/pkg/api/device"
+
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -169,7 +171,7 @@ func TestGetResource(t *testing.T) {
 				ObjectMeta: metav1.ObjectMeta{
 					Name: "test-node",
 					Annotations: map[string]string{
-						"hami.io/node-register-Ascend310P": `[{"id":"id1","devmem":21527},{"id":"id2","devmem":21527}]`,
+						"hami.io/node-register-Ascend310P": `[{"id":"id1","devmem":21527,"health":true},{"id":"id2","devmem":21527,"health":true}]`,
 					},
 				},
 				Status: corev1.NodeStatus{
@@ -191,3 +193,194 @@ func TestGetResource(t *testing.T) {
 		})
 	}
 }
+
+func TestGetResourceTemplates(t *testing.T) {
+	config := VNPUConfig{
+		CommonWord:         "Ascend310P",
+		ChipName:           "310P3",
+		ResourceName:       "huawei.com/Ascend310P",
+		ResourceMemoryName: "huawei.com/Ascend310P-memory",
+		MemoryFactor:       1,
+		AICore:             8,
+		AICPU:              7,
+		Templates: []Template{
+			{Name: "vir01_3c", Memory: 3072, AICore: 3, AICPU: 1},
+			{Name: "vir01", Memory: 3072, AICore: 1, AICPU: 1},
+			{Name: "vir02", Memory: 6144, AICore: 2, AICPU: 2},
+			{Name: "vir01_2cpu", Memory: 3072, AICore: 1, AICPU: 2},
+		},
+		AdvertiseTemplates: true,
+	}
+	dev := InitDevices([]VNPUConfig{config})[0]
+
+	node := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test-node",
+			Annotations: map[string]string{
+				"hami.io/node-register-Ascend310P": `[{"id":"id1","devmem":21527,"devcore":8,"health":true},{"id":"id2","devmem":21527,"devcore":8,"health":true}]`,
+			},
+		},
+		Status: corev1.NodeStatus{
+			Capacity: corev1.ResourceList{
+				corev1.ResourceName(config.ResourceName): resource.MustParse("2"),
+			},
+		},
+	}
+
+	result := dev.GetResource(&node)
+	expected := map[string]int{
+		"Ascend310P-memory":     43054,
+		"Ascend310P-vir01":      14, // memory bound: 21527 / 3072 = 7 per chip
+		"Ascend310P-vir02":      6,  // memory bound: 21527 / 6144 = 3 per chip
+		"Ascend310P-vir01_3c":   4,  // AICore bound: 8 / 3 = 2 per chip
+		"Ascend310P-vir01_2cpu": 6,  // AICPU bound: 7 / 2 = 3 per chip
+	}
+	if len(result) != len(expected) {
+		t.Errorf("expected %d resources, got %v", len(expected), result)
+	}
+	for name, want := range expected {
+		if result[name] != want {
+			t.Errorf("expected %s to be %d, got %d", name, want, result[name])
+		}
+	}
+
+	names := dev.ResourceNames()
+	if len(names) != len(expected) {
+		t.Errorf("expected %d resource names, got %v", len(expected), names)
+	}
+	for _, name := range names {
+		if _, ok := expected[device.GetResourceName(name)]; !ok || device.GetVendorName(name) != "huawei.com" {
+			t.Errorf("unexpected resource name %s", name)
+		}
+	}
+}
+
+func TestGetResourceCompute(t *testing.T) {
+	config := VNPUConfig{
+		CommonWord:         "Ascend910B4",
+		ChipName:           "910B4",
+		ResourceName:       "huawei.com/Ascend910B4",
+		ResourceMemoryName: "huawei.com/Ascend910B4-memory",
+		ResourceAICoreName: "huawei.com/Ascend910B4-aicore",
+		ResourceAICPUName:  "huawei.com/Ascend910B4-aicpu",
+		MemoryFactor:       1,
+		AICore:             20,
+		AICPU:              7,
+	}
+	dev := InitDevices([]VNPUConfig{config})[0]
+
+	node := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test-node",
+			Annotations: map[string]string{
+				"hami.io/node-register-Ascend910B4": `[{"id":"id1","devmem":32768,"health":true},{"id":"id2","devmem":32768,"health":true},{"id":"id3","devmem":32768,"health":false}]`,
+			},
+		},
+		Status: corev1.NodeStatus{
+			Capacity: corev1.ResourceList{
+				corev1.ResourceName(config.ResourceName): resource.MustParse("3"),
+			},
+		},
+	}
+
+	result := dev.GetResource(&node)
+	if result["Ascend910B4-aicore"] != 40 {
+		t.Errorf("expected 40 AI cores, got %d", result["Ascend910B4-aicore"])
+	}
+	if result["Ascend910B4-aicpu"] != 14 {
+		t.Errorf("expected 14 AI CPUs, got %d", result["Ascend910B4-aicpu"])
+	}
+
+	reserved := config
+	reserved.Reserved = device.Reservation{Memory: "2048", Cores: "10%"}
+	result = InitDevices([]VNPUConfig{reserved})[0].GetResource(&node)
+	if result["Ascend910B4-memory"] != 2*(32768-2048) {
+		t.Errorf("expected %d memory after reservation, got %d", 2*(32768-2048), result["Ascend910B4-memory"])
+	}
+	if result["Ascend910B4-aicore"] != 36 {
+		t.Errorf("expected 36 AI cores after reservation, got %d", result["Ascend910B4-aicore"])
+	}
+	if totals := device.GetStatus(config.CommonWord).Reserved; totals == nil || totals.Memory != 4096 || totals.Cores != 4 {
+		t.Errorf("expected reserved memory 4096 and cores 4, got %v", totals)
+	}
+
+	unconfigured := config
+	unconfigured.ResourceAICoreName = ""
+	unconfigured.ResourceAICPUName = ""
+	result = InitDevices([]VNPUConfig{unconfigured})[0].GetResource(&node)
+	if len(result) != 1 {
+		t.Errorf("expected only the memory resource, got %v", result)
+	}
+}
+
+func TestGetResourceMemoryAllocatable(t *testing.T) {
+	testCases := []struct {
+		name              string
+		memoryAllocatable int64
+		memoryCapacity    int64
+		expectedMemory    int
+	}{
+		{
+			name:           "not configured",
+			expectedMemory: 24576 + 21527 + 16384,
+		},
+		{
+			name:              "clamped to allocatable",
+			memoryAllocatable: 21527,
+			memoryCapacity:    24576,
+			expectedMemory:    21527 + 21527 + 16384,
+		},
+		{
+			name:           "capacity only",
+			memoryCapacity: 24576,
+			expectedMemory: 24576 + 21527 + 16384,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := VNPUConfig{
+				CommonWord:         "Ascend310P",
+				ResourceName:       "huawei.com/Ascend310P",
+				ResourceMemoryName: "huawei.com/Ascend310P-memory",
+				MemoryAllocatable:  tc.memoryAllocatable,
+				MemoryCapacity:     tc.memoryCapacity,
+			}
+			dev := InitDevices([]VNPUConfig{config})[0]
+
+			node := corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-node",
+					Annotations: map[string]string{
+						"hami.io/node-register-Ascend310P": `[{"id":"id1","devmem":24576,"health":true},{"id":"id2","devmem":21527,"health":true},{"id":"id3","devmem":16384,"health":true}]`,
+					},
+				},
+				Status: corev1.NodeStatus{
+					Capacity: corev1.ResourceList{
+						corev1.ResourceName(config.ResourceName): resource.MustParse("3"),
+					},
+				},
+			}
+
+			result := dev.GetResource(&node)
+			if result["Ascend310P-memory"] != tc.expectedMemory {
+				t.Errorf("expected memory %d, got %d", tc.expectedMemory, result["Ascend310P-memory"])
+			}
+		})
+	}
+}
+
+func TestRawChipMemoryMismatch(t *testing.T) {
+	dev := &Devices{config: VNPUConfig{MemoryCapacity: 65536, MemoryAllocatable: 65536}}
+
+	if got := dev.rawChipMemory(&device.DeviceInfo{ID: "npu-0", Devmem: 32768}); got != 32768 {
+		t.Errorf("expected memory %d, got %d", 32768, got)
+	}
+	if _, ok := dev.mismatchedMemory.Load("npu-0"); !ok {
+		t.Errorf("expected the mismatch of npu-0 to be remembered")
+	}
+	dev.rawChipMemory(&device.DeviceInfo{ID: "npu-0", Devmem: 65536})
+	if _, ok := dev.mismatchedMemory.Load("npu-0"); ok {
+		t.Errorf("expected the mismatch of npu-0 to be forgotten once it matches")
+	}
+}
@@ -17,20 +17,15 @@ limitations under the License.
 package device
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
-	"os"
+	"fmt"
 	"strconv"
 	"strings"
-	"time"
-
-	"github.com/HAMi/mock-device-plugin/internal/pkg/mock"
-	"github.com/HAMi/mock-device-plugin/internal/pkg/util/client"
+	"sync/atomic"
 
 	"github.com/ccoveille/go-safecast"
 	corev1 "k8s.io/api/core/v1"
-	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/klog/v2"
 )
 
@@ -48,6 +43,9 @@ type DeviceInfo struct {
 	DeviceVendor    string          `json:"devicevendor,omitempty"`
 	CustomInfo      map[string]any  `json:"custominfo,omitempty"`
 	DevicePairScore DevicePairScore `json:"devicepairscore,omitempty"`
+	// HasIndex is whether the register annotation carried the device index, which
+	// legacy 7 field records do not.
+	HasIndex bool `json:"-"`
 }
 
 type MigTemplate struct {
@@ -74,7 +72,9 @@ type Devices interface {
 	CommonWord() string
 	GetNodeDevices(n *corev1.Node) ([]*DeviceInfo, error)
 	GetResource(n *corev1.Node) map[string]int
-	RunManager()
+	// ResourceNames returns the fully qualified names of the resources this device
+	// advertises, e.g. "nvidia.com/gpumem".
+	ResourceNames() []string
 }
 
 type ResourceNames struct {
@@ -93,39 +93,12 @@ const (
 
 var (
 	DevicesMap map[string]Devices
-	ch         = map[string]chan int{}
 )
 
 func GetDevices() map[string]Devices {
 	return DevicesMap
 }
 
-func RunManagers() error {
-	for name, dev := range DevicesMap {
-		klog.Infof("%s run manager", name)
-		ch[name] = make(chan int)
-		go dev.RunManager()
-	}
-	for _, val := range ch {
-		<-val
-	}
-	return nil
-}
-
-func Register(l *mock.MockLister, dev Devices) {
-	nodeName := os.Getenv("NODE_NAME")
-	for {
-		node, err := client.GetClient().CoreV1().Nodes().Get(context.Background(), nodeName, v1.GetOptions{})
-		if err != nil {
-			klog.Error("Get node error", err.Error())
-		} else {
-			resourceMap := dev.GetResource(node)
-			l.SetResource(resourceMap)
-		}
-		time.Sleep(time.Second * 30)
-	}
-}
-
 func GetResourceName(name string) string {
 	if _, after, found := strings.Cut(name, "/"); found {
 		return after
@@ -140,65 +113,221 @@ func GetVendorName(name string) string {
 	return name
 }
 
+// SanitizeResourceName turns an arbitrary string, such as a device type, into a
+// valid resource name segment: characters outside [A-Za-z0-9._-] become '-', runs
+// of separators collapse, and the result starts and ends alphanumeric and is at most
+// 63 characters long.
+func SanitizeResourceName(name string) string {
+	builder := strings.Builder{}
+	lastSeparator := true
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			builder.WriteRune(r)
+			lastSeparator = false
+		case r == '.' || r == '_':
+			if !lastSeparator {
+				builder.WriteRune(r)
+			}
+			lastSeparator = true
+		default:
+			if !lastSeparator {
+				builder.WriteRune('-')
+			}
+			lastSeparator = true
+		}
+	}
+	sanitized := builder.String()
+	if len(sanitized) > 63 {
+		sanitized = sanitized[:63]
+	}
+	return strings.TrimRight(sanitized, "-._")
+}
+
+// QualifyResourceNames joins the last name of each non-empty resource name with
+// namespace, which is how the mock lister will publish it to kubelet.
+func QualifyResourceNames(namespace string, names ...string) []string {
+	var qualified []string
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		qualified = append(qualified, namespace+"/"+GetResourceName(name))
+	}
+	return qualified
+}
+
+// UnMarshalNodeDevices decodes the JSON register annotation. HAMi omits an index of
+// 0, so every JSON record carries an index.
 func UnMarshalNodeDevices(str string) ([]*DeviceInfo, error) {
 	var dlist []*DeviceInfo
-	err := json.Unmarshal([]byte(str), &dlist)
-	return dlist, err
+	if err := json.Unmarshal([]byte(str), &dlist); err != nil {
+		return dlist, err
+	}
+	for _, dev := range dlist {
+		if dev != nil {
+			dev.HasIndex = true
+		}
+	}
+	return dlist, nil
 }
 
+// errDecode is the message of every error of DecodeNodeDevices.
+const errDecode = "node annotations not decode successfully"
+
+// strictDecoding makes DecodeNodeDevices reject malformed numbers and booleans.
+var strictDecoding atomic.Bool
+
+// SetStrictDecoding sets whether DecodeNodeDevices rejects records with a malformed
+// number or boolean instead of zeroing the field.
+func SetStrictDecoding(strict bool) {
+	strictDecoding.Store(strict)
+}
+
+// DecodeError locates what DecodeNodeDevices could not decode.
+type DecodeError struct {
+	// Record is the index of the record in the annotation.
+	Record int
+	// Field names the malformed field, empty when the record has a wrong field count.
+	Field string
+	// Value is the malformed field, or the whole record when Field is empty.
+	Value string
+	Err   error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%s: record %d %q: %v", errDecode, e.Record, e.Value, e.Err)
+	}
+	return fmt.Sprintf("%s: record %d: invalid %s %q: %v", errDecode, e.Record, e.Field, e.Value, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeNodeDevices decodes the legacy register annotation: records of 7 or 9 comma
+// separated fields, each followed by OneContainerMultiDeviceSplitSymbol. A record
+// with a wrong field count fails with a *DecodeError. A malformed number or boolean
+// fails too with SetStrictDecoding, otherwise it is logged and decoded as zero.
 func DecodeNodeDevices(str string) ([]*DeviceInfo, error) {
+	return decodeNodeDevices(str, strictDecoding.Load())
+}
+
+func decodeNodeDevices(str string, strict bool) ([]*DeviceInfo, error) {
 	if !strings.Contains(str, OneContainerMultiDeviceSplitSymbol) {
-		return []*DeviceInfo{}, errors.New("node annotations not decode successfully")
+		return []*DeviceInfo{}, errors.New(errDecode)
 	}
 	tmp := strings.Split(str, OneContainerMultiDeviceSplitSymbol)
 	var retval []*DeviceInfo
-	for _, val := range tmp {
-		if strings.Contains(val, ",") {
-			items := strings.Split(val, ",")
-			if len(items) == 7 || len(items) == 9 {
-				count, _ := strconv.ParseInt(items[1], 10, 32)
-				devmem, _ := strconv.ParseInt(items[2], 10, 32)
-				devcore, _ := strconv.ParseInt(items[3], 10, 32)
-				health, _ := strconv.ParseBool(items[6])
-				numa, _ := strconv.Atoi(items[5])
-				mode := "hami-core"
-				index := 0
-				if len(items) == 9 {
-					index, _ = strconv.Atoi(items[7])
-					mode = items[8]
-				}
-				count32, err := safecast.Convert[int32](count)
-				if err != nil {
-					return []*DeviceInfo{}, errors.New("node annotations not decode successfully")
-				}
-				devmem32, err := safecast.Convert[int32](devmem)
-				if err != nil {
-					return []*DeviceInfo{}, errors.New("node annotations not decode successfully")
-				}
-				devcore32, err := safecast.Convert[int32](devcore)
-				if err != nil {
-					return []*DeviceInfo{}, errors.New("node annotations not decode successfully")
-				}
-				i := DeviceInfo{
-					ID:      items[0],
-					Count:   count32,
-					Devmem:  devmem32,
-					Devcore: devcore32,
-					Type:    items[4],
-					Numa:    numa,
-					Health:  health,
-					Mode:    mode,
-					Index:   uint(index),
-				}
-				retval = append(retval, &i)
-			} else {
-				return []*DeviceInfo{}, errors.New("node annotations not decode successfully")
+	for record, val := range tmp {
+		if !strings.Contains(val, ",") {
+			continue
+		}
+		items := strings.Split(val, ",")
+		if len(items) != 7 && len(items) != 9 {
+			return []*DeviceInfo{}, &DecodeError{
+				Record: record,
+				Value:  val,
+				Err:    fmt.Errorf("got %d fields, want 7 or 9", len(items)),
 			}
 		}
+		d := recordDecoder{record: record, items: items, strict: strict}
+		i := DeviceInfo{
+			ID:      items[0],
+			Count:   d.int32Field(1, "count"),
+			Devmem:  d.int32Field(2, "devmem"),
+			Devcore: d.int32Field(3, "devcore"),
+			Type:    items[4],
+			Numa:    d.intField(5, "numa"),
+			Health:  d.boolField(6, "health"),
+			Mode:    "hami-core",
+		}
+		if len(items) == 9 {
+			i.Index, i.HasIndex = d.indexField(7)
+			i.Mode = items[8]
+		}
+		if d.err != nil {
+			return []*DeviceInfo{}, d.err
+		}
+		retval = append(retval, &i)
 	}
 	return retval, nil
 }
 
+// recordDecoder parses the fields of one record of the legacy register annotation.
+// In strict mode it keeps the first malformed field in err, otherwise it logs every
+// malformed field and the field decodes as zero.
+type recordDecoder struct {
+	record int
+	items  []string
+	strict bool
+	err    error
+}
+
+func (d *recordDecoder) int32Field(pos int, name string) int32 {
+	val, err := strconv.ParseInt(d.items[pos], 10, 32)
+	if err != nil {
+		// ParseInt clamps out of range values, which must not be advertised either.
+		d.fail(pos, name, err)
+		return 0
+	}
+	val32, err := safecast.Convert[int32](val)
+	if err != nil {
+		d.fail(pos, name, err)
+		return 0
+	}
+	return val32
+}
+
+func (d *recordDecoder) intField(pos int, name string) int {
+	val, err := strconv.Atoi(d.items[pos])
+	if err != nil {
+		d.fail(pos, name, err)
+		return 0
+	}
+	return val
+}
+
+func (d *recordDecoder) boolField(pos int, name string) bool {
+	val, err := strconv.ParseBool(d.items[pos])
+	if err != nil {
+		d.fail(pos, name, err)
+		return false
+	}
+	return val
+}
+
+// indexField parses the device index, reporting whether there is one. A negative
+// index is only rejected in strict mode, the lenient decoder keeps converting it like
+// it always did.
+func (d *recordDecoder) indexField(pos int) (uint, bool) {
+	val, err := strconv.Atoi(d.items[pos])
+	if err != nil {
+		d.fail(pos, "index", err)
+		return 0, false
+	}
+	if val < 0 && d.strict {
+		d.fail(pos, "index", errors.New("negative index"))
+	}
+	return uint(val), true
+}
+
+func (d *recordDecoder) fail(pos int, name string, err error) {
+	var numErr *strconv.NumError
+	if errors.As(err, &numErr) {
+		err = numErr.Err
+	}
+	decodeErr := &DecodeError{Record: d.record, Field: name, Value: d.items[pos], Err: err}
+	if !d.strict {
+		klog.InfoS("Decode malformed register annotation field as zero", "err", decodeErr.Error())
+		return
+	}
+	if d.err == nil {
+		d.err = decodeErr
+	}
+}
+
 func EncodeNodeDevices(dlist []*DeviceInfo) string {
 	builder := strings.Builder{}
 	for _, val := range dlist {
@@ -234,11 +363,3 @@ func DecodePairScores(pairScores string) (*DevicePairScores, error) {
 	}
 	return devicePairScores, nil
 }
-
-func CheckHealthy(n *corev1.Node, cardResourceName string) bool {
-	capacity, exists := n.Status.Capacity[corev1.ResourceName(cardResourceName)]
-	if !exists {
-		return false
-	}
-	return !capacity.IsZero()
-}
@@ -17,7 +17,11 @@ limitations under the License.
 package device
 
 import (
+	"encoding/json"
 	"errors"
+	"math"
+	"strconv"
+	"strings"
 	"testing"
 
 	"gotest.tools/v3/assert"
@@ -75,15 +79,16 @@ func Test_DecodeNodeDevices(t *testing.T) {
 			}{
 				di: []*DeviceInfo{
 					{
-						ID:      "GPU-ebe7c3f7-303d-558d-435e-99a160631fe4",
-						Index:   1,
-						Count:   10,
-						Devmem:  7680,
-						Devcore: 100,
-						Type:    "NVIDIA-Tesla P4",
-						Mode:    "hami-core",
-						Numa:    0,
-						Health:  true,
+						ID:       "GPU-ebe7c3f7-303d-558d-435e-99a160631fe4",
+						Index:    1,
+						HasIndex: true,
+						Count:    10,
+						Devmem:   7680,
+						Devcore:  100,
+						Type:     "NVIDIA-Tesla P4",
+						Mode:     "hami-core",
+						Numa:     0,
+						Health:   true,
 					},
 				},
 				err: nil,
@@ -100,4 +105,301 @@ func Test_DecodeNodeDevices(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func Test_SanitizeResourceName(t *testing.T) {
+	tests := []struct {
+		name string
+		args string
+		want string
+	}{
+		{name: "already valid", args: "1g.10gb", want: "1g.10gb"},
+		{name: "spaces", args: "NVIDIA A100-SXM4-80GB", want: "NVIDIA-A100-SXM4-80GB"},
+		{name: "repeated separators", args: "NVIDIA--A10 / PCIe", want: "NVIDIA-A10-PCIe"},
+		{name: "leading and trailing symbols", args: " (Tesla T4) ", want: "Tesla-T4"},
+		{name: "empty", args: "", want: ""},
+		{name: "too long", args: strings.Repeat("a", 70), want: strings.Repeat("a", 63)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, SanitizeResourceName(test.args))
+		})
+	}
+}
+
+// decodeSeeds are register annotations written by HAMi device plugins.
+var decodeSeeds = []string{
+	"GPU-ebe7c3f7-303d-558d-435e-99a160631fe4,10,7680,100,NVIDIA-Tesla P4,0,true:",
+	"GPU-ebe7c3f7-303d-558d-435e-99a160631fe4,10,7680,100,NVIDIA-Tesla P4,0,true,1,hami-core:",
+	"GPU-0fc3eda5-e98b-a25b-5b0d-cf5c855d1448,10,81920,100,NVIDIA-NVIDIA A100-SXM4-80GB,0,true,0,hami-core:GPU-4fb8e8b6-bd86-8fbb-bf1f-1c7a0b4b1e4a,10,81920,100,NVIDIA-NVIDIA A100-SXM4-80GB,0,true,1,mig:",
+	"DCU-TR3A380008110601,4,65520,100,DCU-K100_AI,0,true,2,hami:DCU-TPYX300018090901,4,65520,100,DCU-K100_AI,0,true,3,hami:",
+	"MLU-370-X8-0,10,24576,100,MLU370-X8,0,false:",
+}
+
+// unmarshalSeeds are JSON register annotations written by HAMi device plugins.
+var unmarshalSeeds = []string{
+	`[{"id":"GPU-0","index":4,"count":10,"devmem":81920,"devcore":100,"type":"NVIDIA A100-SXM4-80GB","numa":1,"mode":"hami-core","health":true,"devicepairscore":{}}]`,
+	`[{"id":"DCU-TR3A380008110601","index":0,"count":4,"devmem":65520,"devcore":100,"type":"DCU-K100_AI","health":true}]`,
+	`[{"id":"id1","devmem":21527,"health":true},{"id":"id2","devmem":21527,"health":true}]`,
+	`[{"id":"GPU-1","count":7,"devmem":40960,"type":"NVIDIA A100","mode":"mig","migtemplate":[[{"name":"1g.10gb","memory":10240,"count":7}]],"health":true}]`,
+	`[{"id":"GPU-2","custominfo":{"driver":"535.104.05","nvlink":2},"devicepairscore":{"uuid":"GPU-2","score":{"GPU-3":80}}}]`,
+}
+
+func FuzzEncodeDecodeNodeDevices(f *testing.F) {
+	for _, seed := range decodeSeeds {
+		devs, err := DecodeNodeDevices(seed)
+		if err != nil {
+			f.Fatalf("seed %q: %v", seed, err)
+		}
+		for _, d := range devs {
+			f.Add(d.ID, d.Count, d.Devmem, d.Devcore, d.Type, d.Numa, d.Health, d.Index, d.Mode)
+		}
+	}
+	f.Fuzz(func(t *testing.T, id string, count, devmem, devcore int32, typ string, numa int, health bool, index uint, mode string) {
+		for _, field := range []string{id, typ, mode} {
+			if strings.ContainsAny(field, ","+OneContainerMultiDeviceSplitSymbol) {
+				t.Skip("separators cannot be encoded")
+			}
+		}
+		want := []*DeviceInfo{
+			{ID: id, Count: count, Devmem: devmem, Devcore: devcore, Type: typ, Numa: numa, Health: health, Index: index, HasIndex: true, Mode: mode},
+			{ID: "GPU-1", Count: 10, Devmem: 1024, Devcore: 100, Type: "NVIDIA", Health: true, Index: 1, HasIndex: true, Mode: "hami-core"},
+		}
+		got, err := DecodeNodeDevices(EncodeNodeDevices(want))
+		assert.NilError(t, err)
+		assert.DeepEqual(t, want, got)
+	})
+}
+
+func FuzzDecodeNodeDevices(f *testing.F) {
+	for _, seed := range decodeSeeds {
+		f.Add(seed)
+	}
+	f.Add("GPU-0,ten,7680,100,NVIDIA,0,true:")
+	f.Add("GPU-0,10,99999999999,100,NVIDIA,0,true:")
+	f.Add("GPU-0,10,7680:")
+	f.Add("GPU-0,10,7680,100,NVIDIA,0,true,-1,hami-core:")
+	f.Add("GPU-0,10,7680,100,NVIDIA,0,true:GPU-1,10,7680:")
+	f.Fuzz(func(t *testing.T, annotation string) {
+		lenient, err := decodeNodeDevices(annotation, false)
+		strict, strictErr := decodeNodeDevices(annotation, true)
+		if !strings.Contains(annotation, OneContainerMultiDeviceSplitSymbol) {
+			assert.Assert(t, err != nil && strictErr != nil)
+			assert.Equal(t, len(lenient)+len(strict), 0)
+			return
+		}
+		// Records are decoded in order, the lenient decoder only stops at a wrong
+		// field count, the strict one at the first malformed field as well.
+		var want []*DeviceInfo
+		var wantErr *DecodeError
+		wrongFieldCount := false
+		for record, val := range strings.Split(annotation, OneContainerMultiDeviceSplitSymbol) {
+			if !strings.Contains(val, ",") {
+				continue
+			}
+			items := strings.Split(val, ",")
+			if len(items) != 7 && len(items) != 9 {
+				wrongFieldCount = true
+				if wantErr == nil {
+					wantErr = &DecodeError{Record: record}
+				}
+				break
+			}
+			dev, field := wantRecord(items)
+			if field != "" && wantErr == nil {
+				wantErr = &DecodeError{Record: record, Field: field}
+			}
+			want = append(want, dev)
+		}
+
+		if wrongFieldCount {
+			assert.Assert(t, err != nil)
+			assert.Equal(t, len(lenient), 0, "partial result returned with %v", err)
+		} else {
+			assert.NilError(t, err)
+			assert.DeepEqual(t, lenient, want)
+		}
+		if wantErr == nil {
+			assert.NilError(t, strictErr)
+			assert.DeepEqual(t, strict, want)
+		} else {
+			var decodeErr *DecodeError
+			assert.Assert(t, errors.As(strictErr, &decodeErr), "got %v, want a *DecodeError", strictErr)
+			assert.Equal(t, decodeErr.Record, wantErr.Record)
+			assert.Equal(t, decodeErr.Field, wantErr.Field)
+			assert.Equal(t, len(strict), 0, "partial result returned with %v", strictErr)
+		}
+		if err != nil || len(lenient) == 0 {
+			return
+		}
+		// Whatever was accepted is normalized by a single decode, except that the
+		// encoding always carries the index.
+		for _, d := range lenient {
+			d.HasIndex = true
+		}
+		again, err := DecodeNodeDevices(EncodeNodeDevices(lenient))
+		assert.NilError(t, err)
+		assert.DeepEqual(t, lenient, again)
+	})
+}
+
+// wantRecord returns what a legacy record of 7 or 9 fields decodes to leniently, with
+// every malformed field zeroed, and the first field strict decoding rejects.
+func wantRecord(items []string) (*DeviceInfo, string) {
+	want := &DeviceInfo{ID: items[0], Type: items[4], Mode: "hami-core"}
+	failed := ""
+	fail := func(field string) {
+		if failed == "" {
+			failed = field
+		}
+	}
+	int32Field := func(pos int, field string) int32 {
+		val, err := strconv.ParseInt(items[pos], 10, 32)
+		if err != nil {
+			fail(field)
+			return 0
+		}
+		return int32(val)
+	}
+	want.Count = int32Field(1, "count")
+	want.Devmem = int32Field(2, "devmem")
+	want.Devcore = int32Field(3, "devcore")
+	if numa, err := strconv.Atoi(items[5]); err != nil {
+		fail("numa")
+	} else {
+		want.Numa = numa
+	}
+	if health, err := strconv.ParseBool(items[6]); err != nil {
+		fail("health")
+	} else {
+		want.Health = health
+	}
+	if len(items) == 9 {
+		if index, err := strconv.Atoi(items[7]); err != nil {
+			fail("index")
+		} else {
+			// Negative indices are only rejected by strict decoding.
+			if index < 0 {
+				fail("index")
+			}
+			want.Index, want.HasIndex = uint(index), true
+		}
+		want.Mode = items[8]
+	}
+	return want, failed
+}
+
+func FuzzUnMarshalNodeDevices(f *testing.F) {
+	for _, seed := range unmarshalSeeds {
+		f.Add(seed)
+	}
+	f.Add(`[{"id":"GPU-0","count":"ten"}]`)
+	f.Add(`[{"id":"GPU-0","index":-1}]`)
+	f.Add(`[null]`)
+	f.Fuzz(func(t *testing.T, annotation string) {
+		got, err := UnMarshalNodeDevices(annotation)
+		if err != nil {
+			return
+		}
+		encoded, err := json.Marshal(got)
+		assert.NilError(t, err)
+		again, err := UnMarshalNodeDevices(string(encoded))
+		assert.NilError(t, err)
+		reencoded, err := json.Marshal(again)
+		assert.NilError(t, err)
+		assert.Equal(t, string(encoded), string(reencoded))
+	})
+}
+
+func Test_DecodeNodeDevices_malformedRecords(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   string
+		record int
+		err    string
+	}{
+		{
+			name:   "too few fields",
+			args:   "GPU-0,10,7680,100,NVIDIA,0:",
+			record: 0,
+			err:    `node annotations not decode successfully: record 0 "GPU-0,10,7680,100,NVIDIA,0": got 6 fields, want 7 or 9`,
+		},
+		{
+			name:   "too many fields",
+			args:   "GPU-0,10,7680,100,NVIDIA,0,true,1,hami-core,extra:",
+			record: 0,
+			err:    `node annotations not decode successfully: record 0 "GPU-0,10,7680,100,NVIDIA,0,true,1,hami-core,extra": got 10 fields, want 7 or 9`,
+		},
+		{
+			name:   "second record malformed",
+			args:   "GPU-0,10,7680,100,NVIDIA,0,true:GPU-1,10:",
+			record: 1,
+			err:    `node annotations not decode successfully: record 1 "GPU-1,10": got 2 fields, want 7 or 9`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := DecodeNodeDevices(test.args)
+			assert.Error(t, err, test.err)
+			var decodeErr *DecodeError
+			assert.Assert(t, errors.As(err, &decodeErr))
+			assert.Equal(t, decodeErr.Record, test.record)
+			assert.Equal(t, decodeErr.Field, "")
+			assert.Equal(t, len(got), 0)
+		})
+	}
+}
+
+func Test_decodeNodeDevices_strict(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    string
+		lenient *DeviceInfo
+		err     string
+	}{
+		{
+			name:    "non-numeric devmem",
+			args:    "GPU-0,10,7680,100,NVIDIA,0,true:GPU-1,10,80GB,100,NVIDIA,0,true:",
+			lenient: &DeviceInfo{ID: "GPU-1", Count: 10, Devcore: 100, Type: "NVIDIA", Health: true, Mode: "hami-core"},
+			err:     `node annotations not decode successfully: record 1: invalid devmem "80GB": invalid syntax`,
+		},
+		{
+			name:    "count out of range",
+			args:    "GPU-0,99999999999,7680,100,NVIDIA,0,true:",
+			lenient: &DeviceInfo{ID: "GPU-0", Devmem: 7680, Devcore: 100, Type: "NVIDIA", Health: true, Mode: "hami-core"},
+			err:     `node annotations not decode successfully: record 0: invalid count "99999999999": value out of range`,
+		},
+		{
+			name:    "malformed health",
+			args:    "GPU-0,10,7680,100,NVIDIA,0,yes:",
+			lenient: &DeviceInfo{ID: "GPU-0", Count: 10, Devmem: 7680, Devcore: 100, Type: "NVIDIA", Mode: "hami-core"},
+			err:     `node annotations not decode successfully: record 0: invalid health "yes": invalid syntax`,
+		},
+		{
+			name:    "negative index",
+			args:    "GPU-0,10,7680,100,NVIDIA,0,true,-1,hami-core:",
+			lenient: &DeviceInfo{ID: "GPU-0", Count: 10, Devmem: 7680, Devcore: 100, Type: "NVIDIA", Health: true, Index: math.MaxUint, HasIndex: true, Mode: "hami-core"},
+			err:     `node annotations not decode successfully: record 0: invalid index "-1": negative index`,
+		},
+		{
+			name:    "first malformed field is reported",
+			args:    "GPU-0,ten,,100,NVIDIA,0,true:",
+			lenient: &DeviceInfo{ID: "GPU-0", Devcore: 100, Type: "NVIDIA", Health: true, Mode: "hami-core"},
+			err:     `node annotations not decode successfully: record 0: invalid count "ten": invalid syntax`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := decodeNodeDevices(test.args, false)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, test.lenient, got[len(got)-1])
+
+			got, err = decodeNodeDevices(test.args, true)
+			assert.Error(t, err, test.err)
+			assert.Equal(t, len(got), 0)
+		})
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// AdvertisedAnnos summarises what every vendor currently advertises, e.g.
+	// {"NVIDIA":{"memoryUnit":"MiB","resources":{"nvidia.com/gpumem":245760}}}.
+	AdvertisedAnnos = "hami.io/mock-advertised"
+
+	// Reasons of the Node events emitted when an advertised total changes.
+	ReasonAdvertisementExpired      = "AdvertisementExpired"
+	ReasonAdvertisementRestored     = "AdvertisementRestored"
+	ReasonDevicesUnhealthy          = "DevicesUnhealthy"
+	ReasonDevicesHealthy            = "DevicesHealthy"
+	ReasonDevicesExcluded           = "DevicesExcluded"
+	ReasonMemoryFactorChanged       = "MemoryFactorChanged"
+	ReasonRegisterAnnotationChanged = "RegisterAnnotationChanged"
+
+	eventComponent = "hami-mock-device-plugin"
+)
+
+// Advertised is the AdvertisedAnnos entry of one vendor.
+type Advertised struct {
+	// MemoryUnit is the unit memory resources are counted in, e.g. "MiB" or "1024MiB"
+	// with a memoryFactor of 1024.
+	MemoryUnit string         `json:"memoryUnit"`
+	Resources  map[string]int `json:"resources"`
+	// Overridden lists the resources served with an admin API override.
+	Overridden []string `json:"overridden,omitempty"`
+}
+
+// NewEventRecorder returns a recorder writing events through kubeClient, and the
+// function shutting it down. Events recorded afterwards are dropped.
+func NewEventRecorder(kubeClient kubernetes.Interface) (record.EventRecorder, func()) {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartStructuredLogging(4)
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: eventComponent}), broadcaster.Shutdown
+}
+
+// MemoryUnit returns the unit memory is advertised in with factor.
+func MemoryUnit(factor int32) string {
+	if factor <= 1 {
+		return "MiB"
+	}
+	return fmt.Sprintf("%dMiB", factor)
+}
+
+// RecordMemoryFactor records the memory factor vendor divides its memory by.
+func RecordMemoryFactor(vendor string, factor int32) {
+	updateStatus(vendor, func(status *Status) {
+		status.MemoryFactor = factor
+	})
+}
+
+// recordAdvertisedEvent emits an event on the node when a total advertised by vendor
+// changed between the statuses before and after a sync, or a failed sync that expired
+// them. The first sync has nothing to compare with and is not reported.
+func recordAdvertisedEvent(recorder record.EventRecorder, nodeName, vendor string, prev, cur Status) {
+	if recorder == nil || prev.Advertised == nil {
+		return
+	}
+	changes := advertisedChanges(prev.Advertised, cur.Advertised)
+	if len(changes) == 0 {
+		return
+	}
+	eventType, reason := advertisedChangeReason(prev, cur)
+	// kubelet reports node events with the node name as UID, which is what
+	// kubectl describe node looks for.
+	ref := &corev1.ObjectReference{Kind: "Node", Name: nodeName, UID: types.UID(nodeName)}
+	message := fmt.Sprintf("%s advertised resources changed: %s", vendor, strings.Join(changes, ", "))
+	recorder.Event(ref, eventType, reason, message)
+	klog.InfoS("Advertised resources changed", "vendor", vendor, "reason", reason, "changes", changes)
+}
+
+// advertisedChangeReason returns the type and reason of the event reporting that the
+// advertised totals changed from prev to cur.
+func advertisedChangeReason(prev, cur Status) (string, string) {
+	switch {
+	case cur.SyncState == SyncStateExpired && prev.SyncState != SyncStateExpired:
+		return corev1.EventTypeWarning, ReasonAdvertisementExpired
+	case prev.SyncState == SyncStateExpired && cur.SyncState != SyncStateExpired:
+		return corev1.EventTypeNormal, ReasonAdvertisementRestored
+	case cur.UnhealthyReason != "" && cur.UnhealthyReason != prev.UnhealthyReason,
+		slices.ContainsFunc(cur.UnhealthyDevices, func(id string) bool { return !slices.Contains(prev.UnhealthyDevices, id) }):
+		return corev1.EventTypeWarning, ReasonDevicesUnhealthy
+	case cur.UnhealthyReason != prev.UnhealthyReason || !slices.Equal(cur.UnhealthyDevices, prev.UnhealthyDevices):
+		return corev1.EventTypeNormal, ReasonDevicesHealthy
+	case !slices.Equal(cur.ExcludedDevices, prev.ExcludedDevices):
+		return corev1.EventTypeNormal, ReasonDevicesExcluded
+	case cur.MemoryFactor != prev.MemoryFactor:
+		return corev1.EventTypeNormal, ReasonMemoryFactorChanged
+	}
+	return corev1.EventTypeNormal, ReasonRegisterAnnotationChanged
+}
+
+// advertisedChanges lists the resources whose value differs, as "name: old -> new".
+func advertisedChanges(prev, cur map[string]int) []string {
+	var changes []string
+	for name, val := range cur {
+		if old := prev[name]; old != val {
+			changes = append(changes, fmt.Sprintf("%s: %d -> %d", name, old, val))
+		}
+	}
+	for name, old := range prev {
+		if _, exists := cur[name]; !exists && old != 0 {
+			changes = append(changes, fmt.Sprintf("%s: %d -> 0", name, old))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// AdvertisedAnnotation returns the AdvertisedAnnos value for every vendor that
+// completed a sync, or "" when none did.
+func AdvertisedAnnotation() (string, error) {
+	statusMutex.Lock()
+	advertised := map[string]Advertised{}
+	for vendor, status := range statuses {
+		if status.Advertised != nil {
+			advertised[vendor] = Advertised{
+				MemoryUnit: MemoryUnit(status.MemoryFactor),
+				Resources:  status.Advertised,
+				Overridden: status.Overridden,
+			}
+		}
+	}
+	statusMutex.Unlock()
+	if len(advertised) == 0 {
+		return "", nil
+	}
+	value, err := json.Marshal(advertised)
+	return string(value), err
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"k8s.io/client-go/tools/record"
+)
+
+func Test_recordAdvertisedEvent(t *testing.T) {
+	base := Status{
+		MemoryFactor: 1,
+		Advertised:   map[string]int{"nvidia.com/gpumem": 245760, "nvidia.com/gpucores": 300},
+	}
+	tests := []struct {
+		name      string
+		prev      Status
+		modify    func(cur *Status)
+		wantEvent string
+	}{
+		{
+			name:   "first sync",
+			prev:   Status{},
+			modify: func(cur *Status) {},
+		},
+		{
+			name:   "unchanged",
+			prev:   base,
+			modify: func(cur *Status) {},
+		},
+		{
+			name: "device became unhealthy",
+			prev: base,
+			modify: func(cur *Status) {
+				cur.UnhealthyDevices = []string{"GPU-1"}
+				cur.Advertised = map[string]int{"nvidia.com/gpumem": 163840, "nvidia.com/gpucores": 200}
+			},
+			wantEvent: "Warning DevicesUnhealthy NVIDIA advertised resources changed: nvidia.com/gpucores: 300 -> 200, nvidia.com/gpumem: 245760 -> 163840",
+		},
+		{
+			name: "device recovered",
+			prev: func() Status {
+				prev := base
+				prev.UnhealthyDevices = []string{"GPU-1"}
+				prev.Advertised = map[string]int{"nvidia.com/gpumem": 163840, "nvidia.com/gpucores": 200}
+				return prev
+			}(),
+			modify:    func(cur *Status) {},
+			wantEvent: "Normal DevicesHealthy NVIDIA advertised resources changed: nvidia.com/gpucores: 200 -> 300, nvidia.com/gpumem: 163840 -> 245760",
+		},
+		{
+			name: "one device recovered while another failed",
+			prev: func() Status {
+				prev := base
+				prev.UnhealthyDevices = []string{"GPU-1"}
+				return prev
+			}(),
+			modify: func(cur *Status) {
+				cur.UnhealthyDevices = []string{"GPU-2"}
+				cur.Advertised = map[string]int{"nvidia.com/gpumem": 163840, "nvidia.com/gpucores": 200}
+			},
+			wantEvent: "Warning DevicesUnhealthy NVIDIA advertised resources changed: nvidia.com/gpucores: 300 -> 200, nvidia.com/gpumem: 245760 -> 163840",
+		},
+		{
+			name: "node became unhealthy",
+			prev: base,
+			modify: func(cur *Status) {
+				cur.UnhealthyReason = "handshake expired"
+				cur.Advertised = map[string]int{"nvidia.com/gpumem": 0, "nvidia.com/gpucores": 0}
+			},
+			wantEvent: "Warning DevicesUnhealthy NVIDIA advertised resources changed: nvidia.com/gpucores: 300 -> 0, nvidia.com/gpumem: 245760 -> 0",
+		},
+		{
+			name: "node recovered",
+			prev: func() Status {
+				prev := base
+				prev.UnhealthyReason = "handshake expired"
+				prev.Advertised = map[string]int{"nvidia.com/gpumem": 0, "nvidia.com/gpucores": 0}
+				return prev
+			}(),
+			modify:    func(cur *Status) {},
+			wantEvent: "Normal DevicesHealthy NVIDIA advertised resources changed: nvidia.com/gpucores: 0 -> 300, nvidia.com/gpumem: 0 -> 245760",
+		},
+		{
+			name: "device excluded",
+			prev: base,
+			modify: func(cur *Status) {
+				cur.ExcludedDevices = []string{"GPU-0"}
+				cur.Advertised = map[string]int{"nvidia.com/gpumem": 163840, "nvidia.com/gpucores": 200}
+			},
+			wantEvent: "Normal DevicesExcluded NVIDIA advertised resources changed: nvidia.com/gpucores: 300 -> 200, nvidia.com/gpumem: 245760 -> 163840",
+		},
+		{
+			name: "device no longer excluded",
+			prev: func() Status {
+				prev := base
+				prev.ExcludedDevices = []string{"GPU-0"}
+				prev.Advertised = map[string]int{"nvidia.com/gpumem": 163840, "nvidia.com/gpucores": 200}
+				return prev
+			}(),
+			modify:    func(cur *Status) {},
+			wantEvent: "Normal DevicesExcluded NVIDIA advertised resources changed: nvidia.com/gpucores: 200 -> 300, nvidia.com/gpumem: 163840 -> 245760",
+		},
+		{
+			name: "advertisement expired",
+			prev: func() Status {
+				prev := base
+				prev.SyncState = SyncStateStale
+				return prev
+			}(),
+			modify: func(cur *Status) {
+				cur.SyncState = SyncStateExpired
+				cur.Advertised = map[string]int{"nvidia.com/gpumem": 0, "nvidia.com/gpucores": 0}
+			},
+			wantEvent: "Warning AdvertisementExpired NVIDIA advertised resources changed: nvidia.com/gpucores: 300 -> 0, nvidia.com/gpumem: 245760 -> 0",
+		},
+		{
+			name: "advertisement restored",
+			prev: func() Status {
+				prev := base
+				prev.SyncState = SyncStateExpired
+				prev.Advertised = map[string]int{"nvidia.com/gpumem": 0, "nvidia.com/gpucores": 0}
+				return prev
+			}(),
+			modify: func(cur *Status) {
+				cur.SyncState = SyncStateOK
+			},
+			wantEvent: "Normal AdvertisementRestored NVIDIA advertised resources changed: nvidia.com/gpucores: 0 -> 300, nvidia.com/gpumem: 0 -> 245760",
+		},
+		{
+			name: "memory factor changed",
+			prev: base,
+			modify: func(cur *Status) {
+				cur.MemoryFactor = 2
+				cur.Advertised = map[string]int{"nvidia.com/gpumem": 122880, "nvidia.com/gpucores": 300}
+			},
+			wantEvent: "Normal MemoryFactorChanged NVIDIA advertised resources changed: nvidia.com/gpumem: 245760 -> 122880",
+		},
+		{
+			name: "register annotation changed",
+			prev: base,
+			modify: func(cur *Status) {
+				cur.Advertised = map[string]int{"nvidia.com/gpumem": 327680, "nvidia.com/gpucores": 400}
+			},
+			wantEvent: "Normal RegisterAnnotationChanged NVIDIA advertised resources changed: nvidia.com/gpucores: 300 -> 400, nvidia.com/gpumem: 245760 -> 327680",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(1)
+			cur := base
+			tt.modify(&cur)
+			recordAdvertisedEvent(recorder, "node", "NVIDIA", tt.prev, cur)
+			select {
+			case event := <-recorder.Events:
+				assert.Equal(t, event, tt.wantEvent)
+			default:
+				assert.Equal(t, "", tt.wantEvent, "expected an event")
+			}
+		})
+	}
+}
+
+func Test_AdvertisedAnnotation(t *testing.T) {
+	saved := statuses
+	defer func() { statuses = saved }()
+	statuses = map[string]*Status{}
+
+	value, err := AdvertisedAnnotation()
+	assert.NilError(t, err)
+	assert.Equal(t, value, "")
+
+	RecordMemoryFactor("NVIDIA", 1024)
+	recordSync("NVIDIA", "nvidia.com", map[string]int{"gpumem": 240, "gpucores": 300}, nil)
+	RecordMemoryFactor("DCU", 0)
+	value, err = AdvertisedAnnotation()
+	assert.NilError(t, err)
+	assert.Equal(t, value, `{"NVIDIA":{"memoryUnit":"1024MiB","resources":{"nvidia.com/gpucores":300,"nvidia.com/gpumem":240}}}`)
+}
@@ -0,0 +1,288 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	HealthSourceCapacity    = "capacity"
+	HealthSourceAllocatable = "allocatable"
+	HealthSourceCondition   = "condition"
+	HealthSourceTaint       = "taint"
+	HealthSourceHandshake   = "handshake"
+
+	// DefaultHandshakeTimeout is used when the handshake source is enabled without a timeout.
+	DefaultHandshakeTimeout = 5 * time.Minute
+
+	// HandshakeRequesting, HandshakeReported and HandshakeDeleted prefix the handshake
+	// annotation values written by HAMi's scheduler and device plugins.
+	HandshakeRequesting = "Requesting_"
+	HandshakeReported   = "Reported "
+	HandshakeDeleted    = "Deleted_"
+	// handshakeReportedAlt is the Reported prefix of device plugins that join it to the
+	// timestamp with an underscore.
+	handshakeReportedAlt = "Reported_"
+	// reportedTimeFormat is the layout of time.Time.String() used by Reported timestamps.
+	reportedTimeFormat = "2006-01-02 15:04:05.999999999 -0700 MST"
+)
+
+// handshakeTimeFormats are the timestamp layouts HAMi's scheduler and device plugins
+// write into handshake annotations, tried in order. Layouts without a zone are local
+// time, like the components writing them.
+var handshakeTimeFormats = []string{
+	"2006.01.02 15:04:05",
+	time.DateTime,
+	reportedTimeFormat,
+	time.RFC3339Nano,
+}
+
+// HealthConfig selects the sources that decide whether a node can serve a vendor's
+// devices. Every enabled source has to pass, otherwise the vendor advertises zero.
+type HealthConfig struct {
+	// Sources lists the enabled sources by name, defaults to capacity and handshake.
+	Sources []string `yaml:"sources"`
+	// Conditions are node condition types that mark the node unhealthy while True,
+	// e.g. a GPU problem condition set by node-problem-detector.
+	Conditions []string `yaml:"conditions"`
+	// TaintKeys mark the node unhealthy while a taint with one of these keys is set.
+	TaintKeys []string `yaml:"taintKeys"`
+	// HandshakeTimeout is how old the vendor handshake annotation may get before the
+	// real device plugin is considered gone, defaults to DefaultHandshakeTimeout.
+	HandshakeTimeout time.Duration `yaml:"handshakeTimeout"`
+}
+
+// HealthTarget describes the vendor resources a health source is evaluated for.
+type HealthTarget struct {
+	Vendor            string
+	ResourceCountName string
+	HandshakeAnnos    string
+}
+
+// HealthSource decides whether a node can serve the devices of a vendor. When it
+// cannot, the returned reason explains why.
+type HealthSource interface {
+	Check(n *corev1.Node, target HealthTarget) (bool, string)
+}
+
+// DefaultHealthSources are enabled when the config does not list any source.
+var DefaultHealthSources = []string{HealthSourceCapacity, HealthSourceHandshake}
+
+var healthSources, _ = NewHealthSources(HealthConfig{})
+
+// InitHealthPolicy replaces the health sources used by CheckHealthy.
+func InitHealthPolicy(config HealthConfig) error {
+	sources, err := NewHealthSources(config)
+	if err != nil {
+		return err
+	}
+	healthSources = sources
+	klog.Infof("Health sources: %v", config.Sources)
+	return nil
+}
+
+// NewHealthSources builds the health sources enabled in config, in the order listed.
+func NewHealthSources(config HealthConfig) ([]HealthSource, error) {
+	names := config.Sources
+	if len(names) == 0 {
+		names = DefaultHealthSources
+	}
+	sources := make([]HealthSource, 0, len(names))
+	for _, name := range names {
+		switch name {
+		case HealthSourceCapacity:
+			sources = append(sources, capacitySource{})
+		case HealthSourceAllocatable:
+			sources = append(sources, allocatableSource{})
+		case HealthSourceCondition:
+			if len(config.Conditions) == 0 {
+				return nil, fmt.Errorf("health source %s requires conditions", name)
+			}
+			sources = append(sources, conditionSource{conditions: config.Conditions})
+		case HealthSourceTaint:
+			if len(config.TaintKeys) == 0 {
+				return nil, fmt.Errorf("health source %s requires taintKeys", name)
+			}
+			sources = append(sources, taintSource{keys: config.TaintKeys})
+		case HealthSourceHandshake:
+			timeout := config.HandshakeTimeout
+			if timeout <= 0 {
+				timeout = DefaultHandshakeTimeout
+			}
+			sources = append(sources, handshakeSource{timeout: timeout, now: time.Now})
+		default:
+			return nil, fmt.Errorf("unknown health source %q", name)
+		}
+	}
+	return sources, nil
+}
+
+// CheckHealthy reports whether every health source passes for target on n. The
+// reason of the first failing source is logged and recorded in the vendor status.
+func CheckHealthy(n *corev1.Node, target HealthTarget) bool {
+	reason := ""
+	for _, source := range healthSources {
+		if healthy, why := source.Check(n, target); !healthy {
+			reason = why
+			break
+		}
+	}
+	if reason != "" {
+		klog.InfoS("Node health check failed", "vendor", target.Vendor, "node", n.Name, "reason", reason)
+	}
+	updateStatus(target.Vendor, func(status *Status) {
+		status.UnhealthyReason = reason
+	})
+	return reason == ""
+}
+
+// capacitySource requires a non-zero device count in the node capacity.
+type capacitySource struct{}
+
+func (capacitySource) Check(n *corev1.Node, target HealthTarget) (bool, string) {
+	capacity, exists := n.Status.Capacity[corev1.ResourceName(target.ResourceCountName)]
+	if !exists || capacity.IsZero() {
+		return false, fmt.Sprintf("capacity of %s is zero", target.ResourceCountName)
+	}
+	return true, ""
+}
+
+// allocatableSource requires a non-zero device count in the node allocatable, which
+// follows the device plugin more closely than capacity.
+type allocatableSource struct{}
+
+func (allocatableSource) Check(n *corev1.Node, target HealthTarget) (bool, string) {
+	allocatable, exists := n.Status.Allocatable[corev1.ResourceName(target.ResourceCountName)]
+	if !exists || allocatable.IsZero() {
+		return false, fmt.Sprintf("allocatable of %s is zero", target.ResourceCountName)
+	}
+	return true, ""
+}
+
+// conditionSource fails while any of the listed node conditions is True.
+type conditionSource struct {
+	conditions []string
+}
+
+func (s conditionSource) Check(n *corev1.Node, _ HealthTarget) (bool, string) {
+	for _, condition := range n.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		for _, conditionType := range s.conditions {
+			if string(condition.Type) == conditionType {
+				return false, fmt.Sprintf("node condition %s is True: %s", conditionType, condition.Message)
+			}
+		}
+	}
+	return true, ""
+}
+
+// taintSource fails while the node carries a taint with any of the listed keys.
+type taintSource struct {
+	keys []string
+}
+
+func (s taintSource) Check(n *corev1.Node, _ HealthTarget) (bool, string) {
+	for _, taint := range n.Spec.Taints {
+		for _, key := range s.keys {
+			if taint.Key == key {
+				return false, fmt.Sprintf("node is tainted with %s", taint.ToString())
+			}
+		}
+	}
+	return true, ""
+}
+
+// handshakeSource fails when the vendor handshake annotation has not been refreshed
+// within timeout, i.e. the real device plugin stopped reporting. Vendors without a
+// handshake annotation, and nodes without the annotation, always pass.
+type handshakeSource struct {
+	timeout time.Duration
+	now     func() time.Time
+}
+
+func (s handshakeSource) Check(n *corev1.Node, target HealthTarget) (bool, string) {
+	if target.HandshakeAnnos == "" {
+		return true, ""
+	}
+	value, ok := n.Annotations[target.HandshakeAnnos]
+	if !ok {
+		return true, ""
+	}
+	if strings.HasPrefix(value, HandshakeDeleted) {
+		return false, fmt.Sprintf("handshake %s was deleted: %s", target.HandshakeAnnos, value)
+	}
+	timestamp, err := ParseHandshake(value)
+	recordHandshakeError(target, value, err)
+	if err != nil {
+		return true, ""
+	}
+	if age := s.now().Sub(timestamp); age > s.timeout {
+		return false, fmt.Sprintf("handshake %s is stale: last update %s ago, timeout %s",
+			target.HandshakeAnnos, age.Round(time.Second), s.timeout)
+	}
+	return true, ""
+}
+
+// recordHandshakeError records in the vendor status why the handshake could not be
+// parsed, clearing it once it can. A new error is logged, since the handshake source
+// cannot tell a stale device plugin apart while the format is not understood.
+func recordHandshakeError(target HealthTarget, value string, err error) {
+	reason := ""
+	if err != nil {
+		reason = fmt.Sprintf("unparsable handshake %s: %v", target.HandshakeAnnos, err)
+	}
+	changed := false
+	updateStatus(target.Vendor, func(status *Status) {
+		changed = status.HandshakeError != reason
+		status.HandshakeError = reason
+	})
+	if err != nil && changed {
+		klog.InfoS("Cannot parse handshake, not checking it for staleness", "vendor", target.Vendor,
+			"annotation", target.HandshakeAnnos, "value", value, "err", err)
+	}
+}
+
+// ParseHandshake returns the timestamp of a HAMi handshake annotation value: the
+// Requesting_, Reported or Reported_ prefix followed by a timestamp in one of
+// handshakeTimeFormats.
+func ParseHandshake(value string) (time.Time, error) {
+	timestamp, found := "", false
+	for _, prefix := range []string{HandshakeRequesting, HandshakeReported, handshakeReportedAlt} {
+		if timestamp, found = strings.CutPrefix(value, prefix); found {
+			break
+		}
+	}
+	if !found {
+		return time.Time{}, fmt.Errorf("unknown handshake format %q", value)
+	}
+	// Drop the monotonic clock reading of time.Time.String(), e.g. " m=+3.141592653".
+	timestamp, _, _ = strings.Cut(timestamp, " m=")
+	for _, layout := range handshakeTimeFormats {
+		if t, err := time.ParseInLocation(layout, timestamp, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown handshake timestamp %q", timestamp)
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_NewHealthSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  HealthConfig
+		want    int
+		wantErr bool
+	}{
+		{name: "defaults to capacity and handshake", want: 2},
+		{name: "all sources", config: HealthConfig{
+			Sources:    []string{"capacity", "allocatable", "condition", "taint", "handshake"},
+			Conditions: []string{"GPUProblem"},
+			TaintKeys:  []string{"gpu-unhealthy"},
+		}, want: 5},
+		{name: "condition without conditions", config: HealthConfig{Sources: []string{"condition"}}, wantErr: true},
+		{name: "taint without keys", config: HealthConfig{Sources: []string{"taint"}}, wantErr: true},
+		{name: "unknown source", config: HealthConfig{Sources: []string{"dcgm"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sources, err := NewHealthSources(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewHealthSources() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(sources) != tt.want {
+				t.Errorf("NewHealthSources() returned %d sources, want %d", len(sources), tt.want)
+			}
+		})
+	}
+}
+
+func Test_CheckHealthy(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.Local)
+	target := HealthTarget{Vendor: "test", ResourceCountName: "vendor.com/gpu", HandshakeAnnos: "hami.io/node-handshake"}
+	healthyNode := func() *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "node",
+				Annotations: map[string]string{"hami.io/node-handshake": "Requesting_2025.03.01 11:58:00"},
+			},
+			Status: corev1.NodeStatus{
+				Capacity:    corev1.ResourceList{"vendor.com/gpu": resource.MustParse("2")},
+				Allocatable: corev1.ResourceList{"vendor.com/gpu": resource.MustParse("2")},
+				Conditions:  []corev1.NodeCondition{{Type: "GPUProblem", Status: corev1.ConditionFalse}},
+			},
+		}
+	}
+	sources := []HealthSource{
+		capacitySource{},
+		allocatableSource{},
+		conditionSource{conditions: []string{"GPUProblem"}},
+		taintSource{keys: []string{"gpu-unhealthy"}},
+		handshakeSource{timeout: 5 * time.Minute, now: func() time.Time { return now }},
+	}
+	tests := []struct {
+		name   string
+		modify func(n *corev1.Node)
+		want   bool
+		// wantHandshakeError is whether the handshake is recorded as unparsable.
+		wantHandshakeError bool
+	}{
+		{name: "healthy", modify: func(n *corev1.Node) {}, want: true},
+		{name: "zero capacity", modify: func(n *corev1.Node) {
+			n.Status.Capacity["vendor.com/gpu"] = resource.MustParse("0")
+		}},
+		{name: "missing allocatable", modify: func(n *corev1.Node) {
+			delete(n.Status.Allocatable, "vendor.com/gpu")
+		}},
+		{name: "problem condition", modify: func(n *corev1.Node) {
+			n.Status.Conditions[0].Status = corev1.ConditionTrue
+		}},
+		{name: "tainted", modify: func(n *corev1.Node) {
+			n.Spec.Taints = []corev1.Taint{{Key: "gpu-unhealthy", Effect: corev1.TaintEffectNoSchedule}}
+		}},
+		{name: "stale handshake", modify: func(n *corev1.Node) {
+			n.Annotations["hami.io/node-handshake"] = "Requesting_2025.03.01 11:50:00"
+		}},
+		{name: "deleted handshake", modify: func(n *corev1.Node) {
+			n.Annotations["hami.io/node-handshake"] = "Deleted_2025.03.01 11:59:00"
+		}},
+		{name: "missing handshake", modify: func(n *corev1.Node) {
+			delete(n.Annotations, "hami.io/node-handshake")
+		}, want: true},
+		{name: "unparsable handshake", modify: func(n *corev1.Node) {
+			n.Annotations["hami.io/node-handshake"] = "Requesting_yesterday"
+		}, want: true, wantHandshakeError: true},
+	}
+	saved := healthSources
+	defer func() { healthSources = saved }()
+	healthSources = sources
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := healthyNode()
+			tt.modify(n)
+			if got := CheckHealthy(n, target); got != tt.want {
+				t.Errorf("CheckHealthy() = %v, want %v", got, tt.want)
+			}
+			if reason := GetStatus(target.Vendor).UnhealthyReason; (reason == "") != tt.want {
+				t.Errorf("unexpected unhealthy reason %q", reason)
+			}
+			if reason := GetStatus(target.Vendor).HandshakeError; (reason != "") != tt.wantHandshakeError {
+				t.Errorf("unexpected handshake error %q", reason)
+			}
+		})
+	}
+}
+
+func Test_ParseHandshake(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			name:  "requesting",
+			value: "Requesting_2025.03.01 11:58:00",
+			want:  time.Date(2025, 3, 1, 11, 58, 0, 0, time.Local),
+		},
+		{
+			name:  "requesting date time",
+			value: "Requesting_2025-03-01 11:58:00",
+			want:  time.Date(2025, 3, 1, 11, 58, 0, 0, time.Local),
+		},
+		{
+			name:  "reported",
+			value: "Reported 2025-03-01 11:58:00.123456789 +0800 CST m=+3.141592653",
+			want:  time.Date(2025, 3, 1, 3, 58, 0, 123456789, time.UTC),
+		},
+		{
+			name:  "reported without monotonic clock",
+			value: "Reported 2025-03-01 11:58:00 +0000 UTC",
+			want:  time.Date(2025, 3, 1, 11, 58, 0, 0, time.UTC),
+		},
+		{
+			name:  "reported with underscore",
+			value: "Reported_2025.03.01 11:58:00",
+			want:  time.Date(2025, 3, 1, 11, 58, 0, 0, time.Local),
+		},
+		{
+			name:  "reported RFC 3339",
+			value: "Reported 2025-03-01T11:58:00+08:00",
+			want:  time.Date(2025, 3, 1, 3, 58, 0, 0, time.UTC),
+		},
+		{
+			name:    "unknown timestamp",
+			value:   "Requesting_yesterday",
+			wantErr: true,
+		},
+		{
+			name:    "unknown",
+			value:   "Unknown",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseHandshake(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseHandshake() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(tt.want) {
+				t.Errorf("ParseHandshake() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -20,8 +20,7 @@ import (
 	"errors"
 
 	"github.com/HAMi/mock-device-plugin/internal/pkg/api/device"
-	"github.com/HAMi/mock-device-plugin/internal/pkg/mock"
-	"github.com/kubevirt/device-plugin-manager/pkg/dpm"
+	"github.com/HAMi/mock-device-plugin/internal/pkg/metrics"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/klog/v2"
@@ -32,6 +31,8 @@ type HygonConfig struct {
 	ResourceMemoryName string `yaml:"resourceMemoryName"`
 	ResourceCoreName   string `yaml:"resourceCoreName"`
 	MemoryFactor       int32  `yaml:"memoryFactor"`
+	// Reserved is kept back from every DCU before its memory and cores are advertised.
+	Reserved device.Reservation `yaml:"reserved"`
 }
 
 type DCUDevices struct {
@@ -42,10 +43,12 @@ var (
 	HygonResourceMemory string
 	HygonResourceCores  string
 	MemoryFactor        int32
+	HygonReserved       device.Reservation
 )
 
 const (
 	RegisterAnnos      = "hami.io/node-dcu-register"
+	HandshakeAnnos     = "hami.io/node-handshake-dcu"
 	HygonDCUDevice     = "DCU"
 	HygonDCUCommonWord = "DCU"
 )
@@ -55,6 +58,7 @@ func InitDCUDevice(config HygonConfig) *DCUDevices {
 	HygonResourceMemory = config.ResourceMemoryName
 	HygonResourceCores = config.ResourceCoreName
 	MemoryFactor = config.MemoryFactor
+	HygonReserved = config.Reserved
 	return &DCUDevices{}
 }
 
@@ -67,10 +71,15 @@ func (dev *DCUDevices) GetNodeDevices(n *corev1.Node) ([]*device.DeviceInfo, err
 	if !ok {
 		return []*device.DeviceInfo{}, errors.New("annos not found " + RegisterAnnos)
 	}
-	nodedevices, err := device.DecodeNodeDevices(devEncoded)
+	nodedevices, err := device.UnMarshalNodeDevices(devEncoded)
 	if err != nil {
-		klog.ErrorS(err, "failed to decode node devices", "node", n.Name, "device annotation", devEncoded)
-		return []*device.DeviceInfo{}, err
+		klog.Infof("decode error. try to decode with old method. error %s", err.Error())
+		nodedevices, err = device.DecodeNodeDevices(devEncoded)
+		if err != nil {
+			klog.ErrorS(err, "failed to decode node devices", "node", n.Name, "device annotation", devEncoded)
+			metrics.DecodeFailures.WithLabelValues(dev.CommonWord()).Inc()
+			return []*device.DeviceInfo{}, err
+		}
 	}
 	for idx := range nodedevices {
 		nodedevices[idx].DeviceVendor = HygonDCUCommonWord
@@ -86,34 +95,46 @@ func (dev *DCUDevices) GetNodeDevices(n *corev1.Node) ([]*device.DeviceInfo, err
 
 func (dev *DCUDevices) GetResource(n *corev1.Node) map[string]int {
 	memoryResourceName := device.GetResourceName(HygonResourceMemory)
+	coreResourceName := device.GetResourceName(HygonResourceCores)
 	resourceMap := map[string]int{
 		memoryResourceName: 0,
 	}
-	if !device.CheckHealthy(n, HygonResourceCount) {
+	if coreResourceName != "" {
+		resourceMap[coreResourceName] = 0
+	}
+	device.RecordMemoryFactor(dev.CommonWord(), MemoryFactor)
+	if !device.CheckHealthy(n, device.HealthTarget{
+		Vendor:            dev.CommonWord(),
+		ResourceCountName: HygonResourceCount,
+		HandshakeAnnos:    HandshakeAnnos,
+	}) {
 		klog.Infof("device %s is unhealthy on this node", dev.CommonWord())
+		device.RecordReserved(dev.CommonWord(), nil)
 		return resourceMap
 	}
 	devs, err := dev.GetNodeDevices(n)
 	if err != nil {
 		klog.Infof("no device %s on this node", dev.CommonWord())
+		device.RecordReserved(dev.CommonWord(), nil)
 		return resourceMap
 	}
+	devs = device.UsableDevices(n, dev.CommonWord(), devs)
+	devs = device.ReserveDevices(dev.CommonWord(), HygonReserved, devs)
 	for _, val := range devs {
 		resourceMap[memoryResourceName] += int(val.Devmem)
+		if coreResourceName != "" {
+			resourceMap[coreResourceName] += int(val.Devcore)
+		}
 	}
 	if MemoryFactor > 1 {
 		rawMemory := resourceMap[memoryResourceName]
 		resourceMap[memoryResourceName] /= int(MemoryFactor)
 		klog.InfoS("Update memory", "raw", rawMemory, "after", resourceMap[memoryResourceName], "factor", MemoryFactor)
 	}
-	klog.InfoS("Add resources", memoryResourceName, resourceMap[memoryResourceName])
+	klog.InfoS("Add resources", memoryResourceName, resourceMap[memoryResourceName], coreResourceName, resourceMap[coreResourceName])
 	return resourceMap
 }
 
-func (dev *DCUDevices) RunManager() {
-	lmock := mock.NewMockLister(device.GetVendorName(HygonResourceMemory))
-	device.Register(lmock, dev)
-	mockmanager := dpm.NewManager(lmock)
-	klog.Infof("Running mocking dp: %s", dev.CommonWord())
-	mockmanager.Run()
+func (dev *DCUDevices) ResourceNames() []string {
+	return device.QualifyResourceNames(device.GetVendorName(HygonResourceMemory), HygonResourceMemory, HygonResourceCores)
 }
@@ -60,5 +60,62 @@ func TestDCUDevices_GetResource(t *testing.T) {
 			t.Errorf("Expected total memory %d, got %d", expectedTotalMemory, result[resourceName])
 		}
 
+		coreResourceName := device.GetResourceName(config.ResourceCoreName)
+		expectedTotalCores := 100 * 6
+		if result[coreResourceName] != expectedTotalCores {
+			t.Errorf("Expected total cores %d, got %d", expectedTotalCores, result[coreResourceName])
+		}
+	})
+
+	t.Run("WithJSONAnnotation", func(t *testing.T) {
+		dev := InitDCUDevice(config)
+
+		node := corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "test-node-2",
+				Annotations: map[string]string{
+					RegisterAnnos: `[{"id":"DCU-TR3A380008110601","index":0,"count":4,"devmem":65520,"devcore":100,"type":"DCU-K100_AI","health":true},{"id":"DCU-TPYX300018090901","index":1,"count":4,"devmem":65520,"devcore":60,"type":"DCU-K100_AI","health":true}]`,
+				},
+			},
+			Status: corev1.NodeStatus{
+				Capacity: corev1.ResourceList{
+					corev1.ResourceName(config.ResourceCountName): resource.MustParse("2"),
+				},
+			},
+		}
+
+		result := dev.GetResource(&node)
+		if result["dcumem"] != 65520*2 {
+			t.Errorf("Expected total memory %d, got %d", 65520*2, result["dcumem"])
+		}
+		if result["dcucores"] != 160 {
+			t.Errorf("Expected total cores %d, got %d", 160, result["dcucores"])
+		}
+	})
+
+	t.Run("WithoutCoreResourceName", func(t *testing.T) {
+		dev := InitDCUDevice(HygonConfig{
+			ResourceCountName:  config.ResourceCountName,
+			ResourceMemoryName: config.ResourceMemoryName,
+		})
+
+		node := corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "test-node-3",
+				Annotations: map[string]string{
+					RegisterAnnos: "DCU-TR3A380008110601,4,65520,100,DCU-K100_AI,0,true,0,hami:",
+				},
+			},
+			Status: corev1.NodeStatus{
+				Capacity: corev1.ResourceList{
+					corev1.ResourceName(config.ResourceCountName): resource.MustParse("1"),
+				},
+			},
+		}
+
+		result := dev.GetResource(&node)
+		if len(result) != 1 || result["dcumem"] != 65520 {
+			t.Errorf("Expected only dcumem 65520, got %v", result)
+		}
 	})
 }
@@ -21,10 +21,8 @@ import (
 	"fmt"
 
 	"github.com/HAMi/mock-device-plugin/internal/pkg/api/device"
-	"github.com/HAMi/mock-device-plugin/internal/pkg/mock"
-	"github.com/kubevirt/device-plugin-manager/pkg/dpm"
+	"github.com/HAMi/mock-device-plugin/internal/pkg/metrics"
 
-	//"github.com/kubevirt/device-plugin-manager/pkg/dpm"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/klog/v2"
 )
@@ -37,6 +35,7 @@ const (
 )
 
 var (
+	KunlunResourceCount   string
 	KunlunResourceVCount  string
 	KunlunResourceVMemory string
 )
@@ -51,6 +50,7 @@ type KunlunVDevices struct {
 }
 
 func InitKunlunVDevice(config KunlunConfig) *KunlunVDevices {
+	KunlunResourceCount = config.ResourceCountName
 	KunlunResourceVCount = config.ResourceVCountName
 	KunlunResourceVMemory = config.ResourceVMemoryName
 	return &KunlunVDevices{}
@@ -68,6 +68,7 @@ func (dev *KunlunVDevices) GetNodeDevices(n *corev1.Node) ([]*device.DeviceInfo,
 	nodeDevices, err := device.UnMarshalNodeDevices(anno)
 	if err != nil {
 		klog.ErrorS(err, "failed to unmarshal node devices", "node", n.Name, "device annotation", anno)
+		metrics.DecodeFailures.WithLabelValues(dev.CommonWord()).Inc()
 		return []*device.DeviceInfo{}, err
 	}
 	for idx := range nodeDevices {
@@ -87,11 +88,20 @@ func (dev *KunlunVDevices) GetResource(n *corev1.Node) map[string]int {
 		memoryResourceName: 0,
 		vCountResourceName: 0,
 	}
+	if !device.CheckHealthy(n, device.HealthTarget{
+		Vendor:            dev.CommonWord(),
+		ResourceCountName: KunlunResourceCount,
+		HandshakeAnnos:    HandshakeAnnos,
+	}) {
+		klog.Infof("device %s is unhealthy on this node", dev.CommonWord())
+		return resourceMap
+	}
 	devInfos, err := dev.GetNodeDevices(n)
 	if err != nil || len(devInfos) == 0 {
 		klog.Infof("no device %s on this node", dev.CommonWord())
 		return resourceMap
 	}
+	devInfos = device.UsableDevices(n, dev.CommonWord(), devInfos)
 	for _, val := range devInfos {
 		resourceMap[vCountResourceName] += int(val.Devcore)
 		resourceMap[memoryResourceName] += int(val.Devmem)
@@ -100,10 +110,6 @@ func (dev *KunlunVDevices) GetResource(n *corev1.Node) map[string]int {
 	return resourceMap
 }
 
-func (dev *KunlunVDevices) RunManager() {
-	lmock := mock.NewMockLister(device.GetVendorName(KunlunResourceVCount))
-	device.Register(lmock, dev)
-	mockmanager := dpm.NewManager(lmock)
-	klog.Infof("Running mocking dp: %s", dev.CommonWord())
-	mockmanager.Run()
+func (dev *KunlunVDevices) ResourceNames() []string {
+	return device.QualifyResourceNames(device.GetVendorName(KunlunResourceVCount), KunlunResourceVMemory, KunlunResourceVCount)
 }
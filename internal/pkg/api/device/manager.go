@@ -0,0 +1,466 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HAMi/mock-device-plugin/internal/pkg/metrics"
+	"github.com/HAMi/mock-device-plugin/internal/pkg/mock"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// SyncInterval is how often Register reads the node and updates the plugins.
+const SyncInterval = 30 * time.Second
+
+// Retry delays of Register after a failed node fetch. They grow from
+// syncRetryInitial up to SyncInterval, with up to syncRetryJitter of the delay added.
+const (
+	syncRetryInitial = time.Second
+	syncRetryFactor  = 2.0
+	syncRetryJitter  = 0.5
+)
+
+// Sync states of a vendor, see Status.SyncState.
+const (
+	// SyncStateOK means the last node fetch succeeded.
+	SyncStateOK = "ok"
+	// SyncStateStale means the node could not be fetched and the totals of the last
+	// successful sync are still advertised.
+	SyncStateStale = "stale"
+	// SyncStateExpired means the last successful sync is older than the max staleness
+	// and zero is advertised until the node can be fetched again.
+	SyncStateExpired = "expired"
+)
+
+var syncStates = []string{SyncStateOK, SyncStateStale, SyncStateExpired}
+
+// ManagerOptions tune how the managers sync with the node and stop.
+type ManagerOptions struct {
+	// ShutdownTimeout bounds how long the managers may take to stop once cancelled.
+	ShutdownTimeout time.Duration
+	// MaxStaleness is how long the last known good totals are advertised while the
+	// node cannot be fetched, zero to advertise them until the next successful sync.
+	MaxStaleness time.Duration
+	// DevicePluginPath is the kubelet device plugin directory the plugins are served
+	// in, pluginapi.DevicePluginPath when empty.
+	DevicePluginPath string
+}
+
+var (
+	// eventRecorder reports changes of the advertised totals on the node.
+	eventRecorder record.EventRecorder
+
+	// shuttingDown fails readiness once the managers are asked to stop.
+	shuttingDown atomic.Bool
+
+	ownersMutex sync.Mutex
+	// resourceOwners maps every resource name claimed so far to the vendor serving it.
+	resourceOwners = map[string]string{}
+
+	listersMutex sync.Mutex
+	// listers holds the mock lister of every running manager by vendor common word.
+	listers = map[string]*mock.MockLister{}
+)
+
+// GetLister returns the mock lister serving vendor, nil if its manager is not running.
+func GetLister(vendor string) *mock.MockLister {
+	listersMutex.Lock()
+	defer listersMutex.Unlock()
+	return listers[vendor]
+}
+
+// Listers returns the mock listers of the running managers by vendor common word.
+func Listers() map[string]*mock.MockLister {
+	listersMutex.Lock()
+	defer listersMutex.Unlock()
+	result := make(map[string]*mock.MockLister, len(listers))
+	for vendor, l := range listers {
+		result[vendor] = l
+	}
+	return result
+}
+
+// RunManagers runs a manager for every initialized device and blocks until all of
+// them return. It refuses to start any of them when two devices declare the same
+// resource name. Once ctx is cancelled the managers get opts.ShutdownTimeout to stop
+// their plugins and Register loops, after which an error is returned. The node events
+// recorder is shut down on return.
+func RunManagers(ctx context.Context, kubeClient kubernetes.Interface, opts ManagerOptions) error {
+	if err := claimAllResources(); err != nil {
+		return err
+	}
+	var stopEvents func()
+	eventRecorder, stopEvents = NewEventRecorder(kubeClient)
+	defer stopEvents()
+	var wg sync.WaitGroup
+	var errsMutex sync.Mutex
+	var errs []error
+	for name, dev := range DevicesMap {
+		klog.Infof("%s run manager", name)
+		wg.Add(1)
+		go func(dev Devices) {
+			defer wg.Done()
+			if err := RunManager(ctx, kubeClient, dev, opts); err != nil {
+				errsMutex.Lock()
+				errs = append(errs, err)
+				errsMutex.Unlock()
+			}
+		}(dev)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return errors.Join(errs...)
+	case <-ctx.Done():
+	}
+	shuttingDown.Store(true)
+	klog.InfoS("Shutting down managers", "timeout", opts.ShutdownTimeout)
+	select {
+	case <-stopped:
+		klog.Info("All managers stopped")
+		return errors.Join(errs...)
+	case <-time.After(opts.ShutdownTimeout):
+		return fmt.Errorf("managers did not stop within %s", opts.ShutdownTimeout)
+	}
+}
+
+// RunManager serves the resources of dev to kubelet. It creates the mock lister for
+// the namespace of dev's resources, keeps it in sync with the node in the background
+// and runs the plugin manager on top of it, so vendors only have to describe their
+// devices and resources. The manager stops its plugins and returns once ctx is
+// cancelled; the Register loop is stopped afterwards. It refuses to start when another vendor serves one of the resources of
+// dev, and releases them once it returns.
+func RunManager(ctx context.Context, kubeClient kubernetes.Interface, dev Devices, opts ManagerOptions) error {
+	names := dev.ResourceNames()
+	if len(names) == 0 {
+		klog.Infof("No resources configured for %s, skip running mocking dp", dev.CommonWord())
+		return nil
+	}
+	if err := claimResources(dev); err != nil {
+		return err
+	}
+	defer releaseResources(dev.CommonWord())
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	lmock := mock.NewMockLister(ctx, GetVendorName(names[0]))
+	lmock.OnOverrideChange = func() {
+		recordServed(dev.CommonWord(), lmock)
+	}
+	listersMutex.Lock()
+	listers[dev.CommonWord()] = lmock
+	listersMutex.Unlock()
+	registerStopped := make(chan struct{})
+	go func() {
+		defer close(registerStopped)
+		Register(ctx, kubeClient, lmock, dev, opts)
+	}()
+	klog.Infof("Running mocking dp: %s", dev.CommonWord())
+	dir := opts.DevicePluginPath
+	if dir == "" {
+		dir = pluginapi.DevicePluginPath
+	}
+	mock.NewManager(lmock, dir).Run()
+	klog.Infof("Mocking dp stopped: %s", dev.CommonWord())
+	cancel()
+	<-registerStopped
+	return nil
+}
+
+// Register keeps l in sync with the node until ctx is cancelled. A failed node fetch
+// is retried with a jittered exponential backoff while l keeps serving the totals of
+// the last successful sync, until they get older than opts.MaxStaleness.
+func Register(ctx context.Context, kubeClient kubernetes.Interface, l *mock.MockLister, dev Devices, opts ManagerOptions) {
+	nodeName := os.Getenv("NODE_NAME")
+	vendor := dev.CommonWord()
+	backoff := newSyncBackoff()
+	var lastGood map[string]int
+	for {
+		updateStatus(vendor, func(status *Status) {
+			status.LastHeartbeat = time.Now()
+		})
+		delay := SyncInterval
+		node, err := kubeClient.CoreV1().Nodes().Get(ctx, nodeName, v1.GetOptions{})
+		if err != nil {
+			delay = backoff.Step()
+			prev := GetStatus(vendor)
+			state := syncFailed(l, vendor, lastGood, opts.MaxStaleness, time.Now())
+			recordAdvertisedEvent(eventRecorder, nodeName, vendor, prev, GetStatus(vendor))
+			klog.ErrorS(err, "Get node error", "vendor", vendor, "node", nodeName, "state", state, "retryIn", delay)
+			metrics.NodeFetchErrors.WithLabelValues(vendor).Inc()
+		} else {
+			backoff = newSyncBackoff()
+			prev := GetStatus(vendor)
+			resourceMap := dev.GetResource(node)
+			dropConflicts(vendor, l.Namespace, resourceMap)
+			l.SetResource(resourceMap)
+			lastGood = resourceMap
+			served, overridden := l.Served()
+			recordSync(vendor, l.Namespace, served, overridden)
+			recordAdvertisedEvent(eventRecorder, nodeName, vendor, prev, GetStatus(vendor))
+			if err := publishAnnotations(ctx, kubeClient, node); err != nil {
+				klog.ErrorS(err, "Failed to publish node annotations", "node", nodeName)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			klog.Infof("Stop syncing %s with the node", vendor)
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// claimAllResources claims the resources of every initialized device, so that no
+// manager starts when two of them declare the same resource name.
+func claimAllResources() error {
+	var errs []error
+	for _, dev := range DevicesMap {
+		errs = append(errs, claimResources(dev))
+	}
+	if err := errors.Join(errs...); err != nil {
+		for _, dev := range DevicesMap {
+			releaseResources(dev.CommonWord())
+		}
+		return fmt.Errorf("refusing to start the managers: %w", err)
+	}
+	return nil
+}
+
+// claimResources claims the resource names dev declares. When another vendor claimed
+// one of them first, the claims of dev are released and an error naming the owners
+// is returned.
+func claimResources(dev Devices) error {
+	var errs []error
+	for _, name := range dev.ResourceNames() {
+		if owner, ok := claimResource(dev.CommonWord(), name); !ok {
+			errs = append(errs, fmt.Errorf("resource %s of %s is already served by %s", name, dev.CommonWord(), owner))
+		}
+	}
+	if len(errs) > 0 {
+		releaseResources(dev.CommonWord())
+	}
+	return errors.Join(errs...)
+}
+
+// releaseResources drops every claim of vendor, so that its manager can be started
+// again.
+func releaseResources(vendor string) {
+	ownersMutex.Lock()
+	defer ownersMutex.Unlock()
+	for name, owner := range resourceOwners {
+		if owner == vendor {
+			delete(resourceOwners, name)
+		}
+	}
+}
+
+// claimResource records vendor as the owner of the fully qualified resource name
+// unless another vendor claimed it first, whose common word is then returned.
+func claimResource(vendor, name string) (string, bool) {
+	ownersMutex.Lock()
+	defer ownersMutex.Unlock()
+	if owner, ok := resourceOwners[name]; ok && owner != vendor {
+		return owner, false
+	}
+	resourceOwners[name] = vendor
+	return vendor, true
+}
+
+// dropConflicts removes from resourceMap the resources another vendor serves. The
+// config only rejects conflicts between the names vendors declare up front, names
+// derived from the node, like the per-type NVIDIA resources, are checked here.
+func dropConflicts(vendor, namespace string, resourceMap map[string]int) {
+	for name := range resourceMap {
+		if owner, ok := claimResource(vendor, namespace+"/"+name); !ok {
+			klog.ErrorS(nil, "Not advertising resource already served by another vendor",
+				"resource", namespace+"/"+name, "vendor", vendor, "owner", owner)
+			delete(resourceMap, name)
+		}
+	}
+}
+
+// newSyncBackoff returns the retry delays of Register after failed node fetches.
+func newSyncBackoff() *wait.Backoff {
+	return &wait.Backoff{
+		Duration: syncRetryInitial,
+		Factor:   syncRetryFactor,
+		Jitter:   syncRetryJitter,
+		Steps:    math.MaxInt32,
+		Cap:      SyncInterval,
+	}
+}
+
+// syncFailed records a failed node fetch of vendor and returns its sync state. l keeps
+// serving lastGood, the totals of the last successful sync, until that sync is older
+// than maxStaleness; from then on every resource of lastGood is advertised as zero.
+func syncFailed(l *mock.MockLister, vendor string, lastGood map[string]int, maxStaleness time.Duration, now time.Time) string {
+	var status Status
+	updateStatus(vendor, func(s *Status) {
+		s.ConsecutiveFailures++
+		status = *s
+	})
+	metrics.ConsecutiveSyncFailures.WithLabelValues(vendor).Set(float64(status.ConsecutiveFailures))
+	if lastGood == nil {
+		return status.SyncState
+	}
+	state := SyncStateStale
+	if maxStaleness > 0 && now.Sub(status.LastSync) > maxStaleness {
+		state = SyncStateExpired
+	}
+	if state == SyncStateExpired && status.SyncState != SyncStateExpired {
+		klog.InfoS("Last successful sync is too old, advertising zero", "vendor", vendor,
+			"lastSync", status.LastSync, "maxStaleness", maxStaleness)
+		zero := make(map[string]int, len(lastGood))
+		for name := range lastGood {
+			zero[name] = 0
+		}
+		l.SetResource(zero)
+		recordServed(vendor, l)
+	}
+	recordSyncState(vendor, state)
+	return state
+}
+
+// recordSync records the resources advertised for vendor and the time of the sync in
+// the vendor status and exports them as metrics, along with the unhealthy devices.
+func recordSync(vendor, namespace string, resourceMap map[string]int, overridden []string) {
+	recordAdvertised(vendor, namespace, resourceMap, overridden)
+	var unhealthy int
+	updateStatus(vendor, func(status *Status) {
+		status.LastSync = time.Now()
+		status.ConsecutiveFailures = 0
+		unhealthy = len(status.UnhealthyDevices)
+	})
+	metrics.UnhealthyDevices.WithLabelValues(vendor).Set(float64(unhealthy))
+	recordSyncState(vendor, SyncStateOK)
+	metrics.LastSyncTimestamp.WithLabelValues(vendor).SetToCurrentTime()
+	metrics.ConsecutiveSyncFailures.WithLabelValues(vendor).Set(0)
+}
+
+// recordServed records what l currently serves for vendor, overrides included.
+func recordServed(vendor string, l *mock.MockLister) {
+	served, overridden := l.Served()
+	recordAdvertised(vendor, l.Namespace, served, overridden)
+}
+
+// recordAdvertised records the resources served to kubelet for vendor, and which of
+// them are overridden through the admin API, in the vendor status and exports them
+// as metrics. The series of resources that are no longer served are deleted.
+func recordAdvertised(vendor, namespace string, resourceMap map[string]int, overridden []string) {
+	advertised := make(map[string]int, len(resourceMap))
+	var qualified []string
+	for name, val := range resourceMap {
+		advertised[namespace+"/"+name] = val
+		metrics.AdvertisedResources.WithLabelValues(vendor, namespace+"/"+name).Set(float64(val))
+		isOverridden := 0.0
+		if slices.Contains(overridden, name) {
+			isOverridden = 1
+			qualified = append(qualified, namespace+"/"+name)
+		}
+		metrics.OverriddenResources.WithLabelValues(vendor, namespace+"/"+name).Set(isOverridden)
+	}
+	sort.Strings(qualified)
+	var previous map[string]int
+	updateStatus(vendor, func(status *Status) {
+		previous = status.Advertised
+		status.Advertised = advertised
+		status.Overridden = qualified
+	})
+	for name := range previous {
+		if _, exists := advertised[name]; !exists {
+			metrics.AdvertisedResources.DeleteLabelValues(vendor, name)
+			metrics.OverriddenResources.DeleteLabelValues(vendor, name)
+		}
+	}
+}
+
+// recordSyncState records the sync state of vendor in its status and metrics.
+func recordSyncState(vendor, state string) {
+	updateStatus(vendor, func(status *Status) {
+		status.SyncState = state
+	})
+	for _, s := range syncStates {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		metrics.SyncState.WithLabelValues(vendor, s).Set(value)
+	}
+}
+
+// publishAnnotations patches the ReservedAnnos and AdvertisedAnnos annotations of
+// node when the values recorded by the vendors differ from them, removing them once
+// they are empty.
+func publishAnnotations(ctx context.Context, kubeClient kubernetes.Interface, node *corev1.Node) error {
+	reserved, err := ReservedAnnotation()
+	if err != nil {
+		return err
+	}
+	advertised, err := AdvertisedAnnotation()
+	if err != nil {
+		return err
+	}
+	annotations := map[string]any{}
+	for key, value := range map[string]string{ReservedAnnos: reserved, AdvertisedAnnos: advertised} {
+		current, ok := node.Annotations[key]
+		if current == value && ok == (value != "") {
+			continue
+		}
+		if value == "" {
+			annotations[key] = nil
+		} else {
+			annotations[key] = value
+		}
+	}
+	if len(annotations) == 0 {
+		return nil
+	}
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"annotations": annotations},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = kubeClient.CoreV1().Nodes().Patch(ctx, node.Name, types.MergePatchType, patch, v1.PatchOptions{})
+	if err == nil {
+		klog.InfoS("Publish node annotations", "node", node.Name, "reserved", reserved, "advertised", advertised)
+	}
+	return err
+}
@@ -0,0 +1,284 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/HAMi/mock-device-plugin/internal/pkg/metrics"
+	"github.com/HAMi/mock-device-plugin/internal/pkg/mock"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// countingDevices advertises memory, taken from the "memory" annotation of the node.
+type countingDevices struct {
+	fakeDevices
+}
+
+func (d countingDevices) GetResource(n *corev1.Node) map[string]int {
+	memory, _ := strconv.Atoi(n.Annotations["memory"])
+	return map[string]int{d.commonWord + "-memory": memory}
+}
+
+// namedDevices declares names instead of the resource names of fakeDevices.
+type namedDevices struct {
+	fakeDevices
+	names []string
+}
+
+func (d namedDevices) ResourceNames() []string { return d.names }
+
+func Test_Register(t *testing.T) {
+	savedStatuses := statuses
+	defer func() { statuses = savedStatuses }()
+	statuses = map[string]*Status{}
+	t.Setenv("NODE_NAME", "node")
+
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:        "node",
+		Annotations: map[string]string{"memory": "4"},
+	}}
+	kubeClient := fake.NewSimpleClientset(node)
+	l := mock.NewMockLister(context.Background(), "vendor.com")
+	l.NewPlugin("a-memory")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		Register(ctx, kubeClient, l, countingDevices{fakeDevices{"a"}}, ManagerOptions{})
+	}()
+	for GetStatus("a").SyncState != SyncStateOK {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-stopped
+
+	assert.Equal(t, l.Plugins()[0].Count, 4)
+	assert.DeepEqual(t, GetStatus("a").Advertised, map[string]int{"vendor.com/a-memory": 4})
+	updated, err := kubeClient.CoreV1().Nodes().Get(context.Background(), "node", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, updated.Annotations[AdvertisedAnnos] != "", true, "advertised annotation is published")
+}
+
+func Test_Register_missingNode(t *testing.T) {
+	savedStatuses := statuses
+	defer func() { statuses = savedStatuses }()
+	statuses = map[string]*Status{}
+	t.Setenv("NODE_NAME", "node")
+
+	l := mock.NewMockLister(context.Background(), "vendor.com")
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		Register(ctx, fake.NewSimpleClientset(), l, countingDevices{fakeDevices{"a"}}, ManagerOptions{})
+	}()
+	for GetStatus("a").ConsecutiveFailures < 2 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-stopped
+
+	status := GetStatus("a")
+	assert.Equal(t, status.SyncState, "", "nothing was ever advertised")
+	assert.Assert(t, status.LastSync.IsZero())
+	assert.Equal(t, len(l.Plugins()), 0)
+}
+
+func Test_syncFailed(t *testing.T) {
+	savedStatuses := statuses
+	defer func() { statuses = savedStatuses }()
+	statuses = map[string]*Status{}
+
+	l := mock.NewMockLister(context.Background(), "vendor.com")
+	l.NewPlugin("memory")
+	lastGood := map[string]int{"memory": 1024}
+
+	assert.Equal(t, syncFailed(l, "a", nil, time.Minute, time.Now()), "", "nothing to serve before the first sync")
+
+	l.SetResource(lastGood)
+	recordSync("a", "vendor.com", lastGood, nil)
+	lastSync := GetStatus("a").LastSync
+
+	assert.Equal(t, syncFailed(l, "a", lastGood, time.Minute, lastSync.Add(30*time.Second)), SyncStateStale)
+	assert.Equal(t, l.Plugins()[0].Count, 1024, "last known good totals are kept")
+
+	assert.Equal(t, syncFailed(l, "a", lastGood, time.Minute, lastSync.Add(2*time.Minute)), SyncStateExpired)
+	assert.Equal(t, l.Plugins()[0].Count, 0, "zero is advertised once stale for too long")
+	status := GetStatus("a")
+	assert.Equal(t, status.ConsecutiveFailures, 2)
+	assert.Equal(t, status.Advertised["vendor.com/memory"], 0)
+
+	assert.Equal(t, syncFailed(l, "a", lastGood, 0, lastSync.Add(time.Hour)), SyncStateStale, "zero max staleness never expires")
+
+	l.SetResource(lastGood)
+	recordSync("a", "vendor.com", lastGood, nil)
+	status = GetStatus("a")
+	assert.Equal(t, status.SyncState, SyncStateOK)
+	assert.Equal(t, status.ConsecutiveFailures, 0)
+	assert.Equal(t, l.Plugins()[0].Count, 1024)
+}
+
+func Test_newSyncBackoff(t *testing.T) {
+	backoff := newSyncBackoff()
+	prev := time.Duration(0)
+	for i := 0; i < 10; i++ {
+		delay := backoff.Step()
+		assert.Assert(t, delay >= syncRetryInitial, "delay %s below the initial retry", delay)
+		assert.Assert(t, delay <= time.Duration(float64(SyncInterval)*(1+syncRetryJitter)), "delay %s above the cap", delay)
+		if i < 3 {
+			assert.Assert(t, delay > prev, "delay %s does not grow", delay)
+		}
+		prev = delay
+	}
+}
+
+func Test_dropConflicts(t *testing.T) {
+	savedOwners := resourceOwners
+	defer func() { resourceOwners = savedOwners }()
+	resourceOwners = map[string]string{}
+
+	_, ok := claimResource("a", "vendor.com/a-memory")
+	assert.Assert(t, ok)
+	resourceMap := map[string]int{"a-memory": 1, "b-memory": 2}
+	dropConflicts("b", "vendor.com", resourceMap)
+	assert.DeepEqual(t, resourceMap, map[string]int{"b-memory": 2})
+
+	resourceMap = map[string]int{"a-memory": 3}
+	dropConflicts("a", "vendor.com", resourceMap)
+	assert.DeepEqual(t, resourceMap, map[string]int{"a-memory": 3})
+	owner, ok := claimResource("a", "vendor.com/b-memory")
+	assert.Assert(t, !ok)
+	assert.Equal(t, owner, "b")
+}
+
+func Test_recordSync_unhealthyDevices(t *testing.T) {
+	savedStatuses := statuses
+	defer func() { statuses = savedStatuses }()
+	statuses = map[string]*Status{}
+
+	updateStatus("a", func(status *Status) {
+		status.UnhealthyDevices = []string{"GPU-0", "GPU-1"}
+	})
+	recordSync("a", "vendor.com", map[string]int{"a-memory": 1}, nil)
+	assert.Equal(t, testutil.ToFloat64(metrics.UnhealthyDevices.WithLabelValues("a")), 2.0)
+
+	updateStatus("a", func(status *Status) {
+		status.UnhealthyDevices = nil
+	})
+	recordSync("a", "vendor.com", map[string]int{"a-memory": 1}, nil)
+	assert.Equal(t, testutil.ToFloat64(metrics.UnhealthyDevices.WithLabelValues("a")), 0.0)
+}
+
+func Test_recordServed_overrides(t *testing.T) {
+	savedStatuses := statuses
+	defer func() { statuses = savedStatuses }()
+	statuses = map[string]*Status{}
+
+	// A stopped lister does not wait for the manager to pick up new resources.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l := mock.NewMockLister(ctx, "vendor.com")
+	l.OnOverrideChange = func() { recordServed("a", l) }
+	l.SetResource(map[string]int{"a-memory": 1024, "a-cores": 100})
+	recordServed("a", l)
+
+	l.SetOverride("a-memory", 10, time.Hour)
+	status := GetStatus("a")
+	assert.DeepEqual(t, status.Advertised, map[string]int{"vendor.com/a-memory": 10, "vendor.com/a-cores": 100})
+	assert.DeepEqual(t, status.Overridden, []string{"vendor.com/a-memory"})
+	assert.Equal(t, testutil.ToFloat64(metrics.AdvertisedResources.WithLabelValues("a", "vendor.com/a-memory")), 10.0)
+	assert.Equal(t, testutil.ToFloat64(metrics.OverriddenResources.WithLabelValues("a", "vendor.com/a-memory")), 1.0)
+	annotation, err := AdvertisedAnnotation()
+	assert.NilError(t, err)
+	assert.Equal(t, annotation, `{"a":{"memoryUnit":"MiB","resources":{"vendor.com/a-cores":100,"vendor.com/a-memory":10},"overridden":["vendor.com/a-memory"]}}`)
+
+	l.ClearOverride("a-memory")
+	status = GetStatus("a")
+	assert.DeepEqual(t, status.Advertised, map[string]int{"vendor.com/a-memory": 1024, "vendor.com/a-cores": 100})
+	assert.Assert(t, status.Overridden == nil)
+	assert.Equal(t, testutil.ToFloat64(metrics.OverriddenResources.WithLabelValues("a", "vendor.com/a-memory")), 0.0)
+}
+
+func Test_recordAdvertised_removedResources(t *testing.T) {
+	savedStatuses := statuses
+	defer func() { statuses = savedStatuses }()
+	statuses = map[string]*Status{}
+
+	recordAdvertised("c", "vendor.com", map[string]int{"c-memory": 1024, "c-memory-a100": 512}, nil)
+	recordAdvertised("c", "vendor.com", map[string]int{"c-memory": 1024}, nil)
+	assert.Equal(t, testutil.ToFloat64(metrics.AdvertisedResources.WithLabelValues("c", "vendor.com/c-memory")), 1024.0)
+	assert.Assert(t, !metrics.AdvertisedResources.DeleteLabelValues("c", "vendor.com/c-memory-a100"), "no longer advertised")
+	assert.Assert(t, !metrics.OverriddenResources.DeleteLabelValues("c", "vendor.com/c-memory-a100"), "no longer advertised")
+}
+
+func Test_RunManagers_conflict(t *testing.T) {
+	savedDevices, savedOwners := DevicesMap, resourceOwners
+	defer func() { DevicesMap, resourceOwners = savedDevices, savedOwners }()
+	resourceOwners = map[string]string{}
+	DevicesMap = map[string]Devices{
+		"a": fakeDevices{"a"},
+		"b": namedDevices{fakeDevices{"b"}, []string{"vendor.com/a-memory"}},
+	}
+
+	err := RunManagers(context.Background(), fake.NewSimpleClientset(), ManagerOptions{})
+	assert.ErrorContains(t, err, "resource vendor.com/a-memory of")
+	assert.Equal(t, len(resourceOwners), 0, "no resource stays claimed")
+}
+
+func Test_RunManagers_shutdown(t *testing.T) {
+	savedStatuses, savedDevices, savedListers, savedOwners := statuses, DevicesMap, listers, resourceOwners
+	defer func() {
+		statuses, DevicesMap, listers, resourceOwners = savedStatuses, savedDevices, savedListers, savedOwners
+		shuttingDown.Store(false)
+	}()
+	statuses = map[string]*Status{}
+	listers = map[string]*mock.MockLister{}
+	resourceOwners = map[string]string{}
+	DevicesMap = map[string]Devices{
+		"a": countingDevices{fakeDevices{"a"}},
+		"b": countingDevices{fakeDevices{"b"}},
+	}
+	t.Setenv("NODE_NAME", "node")
+	kubeClient := fake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() {
+		result <- RunManagers(ctx, kubeClient, ManagerOptions{ShutdownTimeout: 10 * time.Second, DevicePluginPath: t.TempDir()})
+	}()
+	for GetStatus("a").SyncState != SyncStateOK || GetStatus("b").SyncState != SyncStateOK {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case err := <-result:
+		assert.NilError(t, err, "the managers stop before the shutdown timeout")
+	case <-time.After(20 * time.Second):
+		t.Fatalf("RunManagers did not return after ctx was cancelled")
+	}
+	assert.Equal(t, len(resourceOwners), 0, "stopped managers release their resources")
+}
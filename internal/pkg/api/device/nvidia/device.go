@@ -18,11 +18,11 @@ package nvidia
 
 import (
 	"errors"
+	"sort"
 	"strings"
 
 	"github.com/HAMi/mock-device-plugin/internal/pkg/api/device"
-	"github.com/HAMi/mock-device-plugin/internal/pkg/mock"
-	"github.com/kubevirt/device-plugin-manager/pkg/dpm"
+	"github.com/HAMi/mock-device-plugin/internal/pkg/metrics"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/klog/v2"
@@ -30,11 +30,13 @@ import (
 
 const (
 	RegisterAnnos        = "hami.io/node-nvidia-register"
+	HandshakeAnnos       = "hami.io/node-handshake"
 	RegisterGPUPairScore = "hami.io/node-nvidia-score"
 	NvidiaGPUDevice      = "NVIDIA"
 	NvidiaGPUCommonWord  = "GPU"
 	Vendor               = "nvidia.com"
 	MigMode              = "mig"
+	MigProfilePrefix     = "mig-"
 )
 
 type LibCudaLogLevel string
@@ -56,10 +58,24 @@ type NvidiaConfig struct {
 	// TODO Whether these should be removed
 	DisableCoreLimit  bool                   `yaml:"disableCoreLimit"`
 	MigGeometriesList []AllowedMigGeometries `yaml:"knownMigGeometries"`
+	// AdvertiseMigProfiles also publishes one resource per MIG profile, e.g.
+	// nvidia.com/mig-1g.10gb, counted from the largest allowed geometry of each MIG device.
+	AdvertiseMigProfiles bool `yaml:"advertiseMigProfiles"`
+	// AdvertisePerTypeResources also publishes memory and cores per GPU model next to the
+	// aggregates, e.g. nvidia.com/gpumem-A100-SXM4-80GB.
+	AdvertisePerTypeResources bool `yaml:"advertisePerTypeResources"`
+	// ScaleRegisteredDevices applies deviceMemoryScaling and deviceCoreScaling to the
+	// memory and cores of the register annotation. HAMi's device plugin writes them
+	// already scaled, so only enable it for annotations written without scaling.
+	ScaleRegisteredDevices bool `yaml:"scaleRegisteredDevices"`
+	// Reserved is kept back from every GPU before its memory and cores are advertised.
+	Reserved device.Reservation `yaml:"reserved"`
 	// GPUCorePolicy through webhook automatic injected to container env
 	GPUCorePolicy GPUCoreUtilizationPolicy `yaml:"gpuCorePolicy"`
 	// RuntimeClassName is the name of the runtime class to be added to pod.spec.runtimeClassName
 	RuntimeClassName string `yaml:"runtimeClassName"`
+	// NodeConfigs is filled from the top-level nodeconfig list.
+	NodeConfigs []NodeConfig `yaml:"-"`
 }
 
 type AllowedMigGeometries struct {
@@ -67,7 +83,9 @@ type AllowedMigGeometries struct {
 	Geometries []device.Geometry `yaml:"allowedGeometries"`
 }
 
-// These configs can be specified for each node by using Nodeconfig.
+// These configs can be specified for each node by using Nodeconfig. DeviceSplitCount
+// and LogLevel are accepted for compatibility with HAMi but do not affect the totals:
+// the split count is already part of the register annotation.
 type NodeDefaultConfig struct {
 	DeviceSplitCount    *uint    `yaml:"deviceSplitCount" json:"devicesplitcount"`
 	DeviceMemoryScaling *float64 `yaml:"deviceMemoryScaling" json:"devicememoryscaling"`
@@ -76,6 +94,31 @@ type NodeDefaultConfig struct {
 	LogLevel *LibCudaLogLevel `yaml:"libCudaLogLevel" json:"libcudaloglevel"`
 }
 
+// NodeConfig overrides NodeDefaultConfig and memoryFactor on the nodes it matches.
+// An entry matches when its name equals the node name and every nodeSelector label
+// is set on the node; either may be omitted, but not both.
+type NodeConfig struct {
+	Name              string            `yaml:"name"`
+	NodeSelector      map[string]string `yaml:"nodeSelector"`
+	NodeDefaultConfig `yaml:",inline"`
+	MemoryFactor      *int32 `yaml:"memoryFactor"`
+}
+
+func (nc *NodeConfig) matches(n *corev1.Node) bool {
+	if nc.Name == "" && len(nc.NodeSelector) == 0 {
+		return false
+	}
+	if nc.Name != "" && nc.Name != n.Name {
+		return false
+	}
+	for key, val := range nc.NodeSelector {
+		if label, ok := n.Labels[key]; !ok || label != val {
+			return false
+		}
+	}
+	return true
+}
+
 type NvidiaGPUDevices struct {
 	config         NvidiaConfig
 	ReportedGPUNum int64
@@ -104,6 +147,7 @@ func (dev *NvidiaGPUDevices) GetNodeDevices(n *corev1.Node) ([]*device.DeviceInf
 		nodedevices, err = device.DecodeNodeDevices(devEncoded)
 		if err != nil {
 			klog.ErrorS(err, "failed to decode node devices", "node", n.Name, "device annotation", devEncoded)
+			metrics.DecodeFailures.WithLabelValues(dev.CommonWord()).Inc()
 			return []*device.DeviceInfo{}, err
 		}
 	}
@@ -162,32 +206,78 @@ func (dev *NvidiaGPUDevices) GetNodeDevices(n *corev1.Node) ([]*device.DeviceInf
 }
 
 func (dev *NvidiaGPUDevices) GetResource(n *corev1.Node) map[string]int {
-	memoryResourceName := device.GetResourceName(dev.config.ResourceMemoryName)
-	coreResourceName := device.GetResourceName(dev.config.ResourceCoreName)
-	memoryPercentageName := device.GetResourceName(dev.config.ResourceMemoryPercentageName)
+	config := dev.configForNode(n)
+	memoryResourceName := device.GetResourceName(config.ResourceMemoryName)
+	coreResourceName := device.GetResourceName(config.ResourceCoreName)
+	memoryPercentageName := device.GetResourceName(config.ResourceMemoryPercentageName)
 	resourceMap := map[string]int{
 		memoryResourceName:   0,
 		coreResourceName:     0,
 		memoryPercentageName: 0,
 	}
-	if !device.CheckHealthy(n, dev.config.ResourceCountName) {
+	device.RecordMemoryFactor(dev.CommonWord(), config.MemoryFactor)
+	if !device.CheckHealthy(n, device.HealthTarget{
+		Vendor:            dev.CommonWord(),
+		ResourceCountName: config.ResourceCountName,
+		HandshakeAnnos:    HandshakeAnnos,
+	}) {
 		klog.Infof("device %s is unhealthy on this node", dev.CommonWord())
+		device.RecordReserved(dev.CommonWord(), nil)
 		return resourceMap
 	}
 	devs, err := dev.GetNodeDevices(n)
 	if err != nil {
 		klog.Infof("no device %s on this node", NvidiaGPUCommonWord)
+		device.RecordReserved(dev.CommonWord(), nil)
 		return resourceMap
 	}
+	devs = device.UsableDevices(n, dev.CommonWord(), devs)
+	devs = device.ReserveDevices(dev.CommonWord(), config.Reserved, devs)
+	// HAMi's device plugin registers every device with its memory and cores already
+	// multiplied by the scaling, and gpumem-percentage is a share of that scaled memory,
+	// so each device offers 100 whatever the scaling.
+	memoryScaling, coreScaling := 1.0, 1.0
+	if config.ScaleRegisteredDevices {
+		memoryScaling = scalingFactor(config.DeviceMemoryScaling)
+		coreScaling = scalingFactor(config.DeviceCoreScaling)
+		klog.V(4).InfoS("Scale registered devices", "memoryScaling", memoryScaling, "coreScaling", coreScaling)
+	}
+	perTypeMemory := make(map[string]int)
+	perTypeCore := make(map[string]int)
 	for _, val := range devs {
-		resourceMap[memoryResourceName] += int(val.Devmem)
-		resourceMap[coreResourceName] += int(val.Devcore)
+		memory := int(float64(val.Devmem) * memoryScaling)
+		core := int(float64(val.Devcore) * coreScaling)
+		resourceMap[memoryResourceName] += memory
+		resourceMap[coreResourceName] += core
 		resourceMap[memoryPercentageName] += 100
+		if model := modelName(val.Type); config.AdvertisePerTypeResources && model != "" {
+			perTypeMemory[device.SanitizeResourceName(memoryResourceName+"-"+model)] += memory
+			perTypeCore[device.SanitizeResourceName(coreResourceName+"-"+model)] += core
+		}
 	}
-	if dev.config.MemoryFactor > 1 {
+	if config.AdvertiseMigProfiles {
+		migProfiles := migProfileCounts(devs)
+		for name, count := range migProfiles {
+			resourceMap[name] += count
+		}
+		klog.InfoS("Add MIG profile resources", "profiles", migProfiles)
+	}
+	if config.MemoryFactor > 1 {
 		rawMemory := resourceMap[memoryResourceName]
-		resourceMap[memoryResourceName] /= int(dev.config.MemoryFactor)
-		klog.InfoS("Update memory", "raw", rawMemory, "after", resourceMap[memoryResourceName], "factor", dev.config.MemoryFactor)
+		resourceMap[memoryResourceName] /= int(config.MemoryFactor)
+		klog.InfoS("Update memory", "raw", rawMemory, "after", resourceMap[memoryResourceName], "factor", config.MemoryFactor)
+		for name := range perTypeMemory {
+			perTypeMemory[name] /= int(config.MemoryFactor)
+		}
+	}
+	if config.AdvertisePerTypeResources {
+		for name, val := range perTypeMemory {
+			resourceMap[name] = val
+		}
+		for name, val := range perTypeCore {
+			resourceMap[name] = val
+		}
+		klog.InfoS("Add per-type resources", "memory", perTypeMemory, "cores", perTypeCore)
 	}
 	klog.InfoS("Add resources",
 		memoryResourceName,
@@ -200,10 +290,114 @@ func (dev *NvidiaGPUDevices) GetResource(n *corev1.Node) map[string]int {
 	return resourceMap
 }
 
-func (dev *NvidiaGPUDevices) RunManager() {
-	lmock := mock.NewMockLister(Vendor)
-	go device.Register(lmock, dev)
-	mockmanager := dpm.NewManager(lmock)
-	klog.Infof("Running mocking dp: %s", dev.CommonWord())
-	mockmanager.Run()
+// modelName strips the vendor prefix from a device type, so that both
+// "NVIDIA A100-SXM4-80GB" and the legacy "NVIDIA-NVIDIA A100-SXM4-80GB" yield
+// "A100-SXM4-80GB".
+func modelName(deviceType string) string {
+	model := strings.TrimSpace(deviceType)
+	for {
+		rest, found := strings.CutPrefix(model, NvidiaGPUDevice)
+		if !found || (rest != "" && rest[0] != ' ' && rest[0] != '-') {
+			return model
+		}
+		model = strings.TrimLeft(rest, " -")
+	}
+}
+
+// migProfileCounts counts the instances of every MIG profile that the largest
+// allowed geometry of each MIG device provides, keyed by resource name.
+func migProfileCounts(devs []*device.DeviceInfo) map[string]int {
+	counts := make(map[string]int)
+	for _, val := range devs {
+		if val.Mode != MigMode {
+			continue
+		}
+		for _, template := range largestGeometry(val.MIGTemplate) {
+			counts[MigProfilePrefix+device.SanitizeResourceName(template.Name)] += int(template.Count)
+		}
+	}
+	return counts
+}
+
+// largestGeometry returns the geometry that carves the most memory out of a device,
+// preferring the one with more instances when two carve the same amount.
+func largestGeometry(geometries []device.Geometry) device.Geometry {
+	var largest device.Geometry
+	largestMemory, largestCount := int64(-1), int32(0)
+	for _, geometry := range geometries {
+		memory, count := int64(0), int32(0)
+		for _, template := range geometry {
+			memory += int64(template.Memory) * int64(template.Count)
+			count += template.Count
+		}
+		if memory > largestMemory || (memory == largestMemory && count > largestCount) {
+			largest, largestMemory, largestCount = geometry, memory, count
+		}
+	}
+	return largest
+}
+
+// configForNode returns the device config with every nodeconfig entry matching n
+// applied in order, so later entries win.
+func (dev *NvidiaGPUDevices) configForNode(n *corev1.Node) NvidiaConfig {
+	config := dev.config
+	for _, nc := range dev.config.NodeConfigs {
+		if !nc.matches(n) {
+			continue
+		}
+		if nc.DeviceSplitCount != nil {
+			config.DeviceSplitCount = nc.DeviceSplitCount
+		}
+		if nc.DeviceMemoryScaling != nil {
+			config.DeviceMemoryScaling = nc.DeviceMemoryScaling
+		}
+		if nc.DeviceCoreScaling != nil {
+			config.DeviceCoreScaling = nc.DeviceCoreScaling
+		}
+		if nc.LogLevel != nil {
+			config.LogLevel = nc.LogLevel
+		}
+		if nc.MemoryFactor != nil {
+			config.MemoryFactor = *nc.MemoryFactor
+		}
+		klog.V(4).InfoS("Apply node config", "node", n.Name, "name", nc.Name, "nodeSelector", nc.NodeSelector)
+	}
+	return config
+}
+
+// scalingFactor returns the configured scaling, treating an unset or non-positive
+// value as no scaling.
+func scalingFactor(factor *float64) float64 {
+	if factor == nil || *factor <= 0 {
+		return 1
+	}
+	return *factor
+}
+
+// ResourceNames returns the aggregate resources and, with AdvertiseMigProfiles, every
+// MIG profile of the known geometries. The per-type resources depend on the models
+// found on the node, so they are only checked for conflicts once they are advertised.
+func (dev *NvidiaGPUDevices) ResourceNames() []string {
+	names := []string{
+		dev.config.ResourceMemoryName,
+		dev.config.ResourceCoreName,
+		dev.config.ResourceMemoryPercentageName,
+	}
+	if dev.config.AdvertiseMigProfiles {
+		profiles := make(map[string]bool)
+		for _, migGeometries := range dev.config.MigGeometriesList {
+			for _, geometry := range migGeometries.Geometries {
+				for _, template := range geometry {
+					profiles[MigProfilePrefix+device.SanitizeResourceName(template.Name)] = true
+				}
+			}
+		}
+		sorted := make([]string, 0, len(profiles))
+		for name := range profiles {
+			sorted = append(sorted, name)
+		}
+		sort.Strings(sorted)
+		names = append(names, sorted...)
+	}
+	return device.QualifyResourceNames(Vendor, names...)
 }
@@ -16,7 +16,11 @@ limitations under the License.
 package nvidia
 
 import (
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/HAMi/mock-device-plugin/internal/pkg/api/device"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -86,6 +90,172 @@ func TestGetResource(t *testing.T) {
 		}
 
 	})
+
+	t.Run("Test Nvidia unhealthy device is not advertised", func(t *testing.T) {
+		unhealthyNode := node.DeepCopy()
+		unhealthyNode.Annotations[RegisterAnnos] = `[
+		{"id":"GPU-0","index":4,"count":10,"devmem":81920,"devcore":100,"type":"NVIDIA A100-SXM4-80GB","numa":1,"mode":"hami-core","health":true},
+		{"id":"GPU-1","index":5,"count":10,"devmem":81920,"devcore":100,"type":"NVIDIA A100-SXM4-80GB","numa":1,"mode":"hami-core","health":false},
+		{"id":"GPU-2","index":6,"count":10,"devmem":81920,"devcore":100,"type":"NVIDIA A100-SXM4-80GB","numa":1,"mode":"hami-core","health":true}
+		]`
+		result := dev.GetResource(unhealthyNode)
+
+		if result["gpu-memory"] != 163840 {
+			t.Errorf("expected total memory %d, got %d", 163840, result["gpu-memory"])
+		}
+		if result["gpu-core"] != 200 {
+			t.Errorf("expected total core %d, got %d", 200, result["gpu-core"])
+		}
+		if result["gpu-memory-percentage"] != 200 {
+			t.Errorf("expected total memory percentage %d, got %d", 200, result["gpu-memory-percentage"])
+		}
+		status := device.GetStatus(dev.CommonWord())
+		if len(status.UnhealthyDevices) != 1 || status.UnhealthyDevices[0] != "GPU-1" {
+			t.Errorf("expected GPU-1 to be recorded as unhealthy, got %v", status.UnhealthyDevices)
+		}
+	})
+
+	t.Run("Test Nvidia excluded device is not advertised", func(t *testing.T) {
+		excludedNode := node.DeepCopy()
+		excludedNode.Annotations[device.ExcludedDevicesAnnos] = "GPU-2"
+		result := dev.GetResource(excludedNode)
+		if result["gpu-memory"] != 163840 {
+			t.Errorf("expected total memory %d, got %d", 163840, result["gpu-memory"])
+		}
+		if result["gpu-core"] != 200 {
+			t.Errorf("expected total core %d, got %d", 200, result["gpu-core"])
+		}
+		status := device.GetStatus(dev.CommonWord())
+		if len(status.ExcludedDevices) != 1 || status.ExcludedDevices[0] != "GPU-2" {
+			t.Errorf("expected GPU-2 to be recorded as excluded, got %v", status.ExcludedDevices)
+		}
+	})
+
+	t.Run("Test Nvidia reserved headroom is not advertised", func(t *testing.T) {
+		reservedConfig := config
+		reservedConfig.Reserved = device.Reservation{Memory: "10%", Cores: "5"}
+		reservedDev := InitNvidiaDevice(reservedConfig)
+		result := reservedDev.GetResource(&node)
+		if result["gpu-memory"] != 221184 {
+			t.Errorf("expected total memory %d, got %d", 221184, result["gpu-memory"])
+		}
+		if result["gpu-core"] != 285 {
+			t.Errorf("expected total core %d, got %d", 285, result["gpu-core"])
+		}
+		reserved := device.GetStatus(dev.CommonWord()).Reserved
+		if reserved == nil || reserved.Memory != 24576 || reserved.Cores != 15 {
+			t.Errorf("expected reserved memory 24576 and cores 15, got %v", reserved)
+		}
+		unhealthyNode := node.DeepCopy()
+		unhealthyNode.Status.Capacity = nil
+		reservedDev.GetResource(unhealthyNode)
+		if reserved := device.GetStatus(dev.CommonWord()).Reserved; reserved != nil {
+			t.Errorf("expected no reservation on an unhealthy node, got %v", reserved)
+		}
+	})
+
+	t.Run("Test Nvidia stale handshake stops advertising", func(t *testing.T) {
+		handshakeNode := node.DeepCopy()
+		handshakeNode.Annotations[HandshakeAnnos] = device.HandshakeRequesting + time.Now().Add(-time.Hour).Format("2006.01.02 15:04:05")
+		result := dev.GetResource(handshakeNode)
+		if result["gpu-memory"] != 0 || result["gpu-core"] != 0 {
+			t.Errorf("expected no resources with a stale handshake, got %v", result)
+		}
+		if reason := device.GetStatus(dev.CommonWord()).UnhealthyReason; !strings.Contains(reason, "stale") {
+			t.Errorf("expected a stale handshake reason, got %q", reason)
+		}
+
+		handshakeNode.Annotations[HandshakeAnnos] = device.HandshakeReported + time.Now().String()
+		result = dev.GetResource(handshakeNode)
+		if result["gpu-memory"] != 245760 {
+			t.Errorf("expected total memory %d after a fresh handshake, got %d", 245760, result["gpu-memory"])
+		}
+		if reason := device.GetStatus(dev.CommonWord()).UnhealthyReason; reason != "" {
+			t.Errorf("expected no unhealthy reason, got %q", reason)
+		}
+	})
+
+	float64Ptr := func(f float64) *float64 { return &f }
+	scalingCases := []struct {
+		name                string
+		scaleRegistered     bool
+		memoryScaling       *float64
+		coreScaling         *float64
+		memoryFactor        int32
+		expectedMemory      int
+		expectedCore        int
+		expectedMemoryRatio int
+	}{
+		{
+			name:                "no scaling configured",
+			scaleRegistered:     true,
+			expectedMemory:      245760,
+			expectedCore:        300,
+			expectedMemoryRatio: 300,
+		},
+		{
+			name:                "annotation already scaled by HAMi",
+			memoryScaling:       float64Ptr(1.5),
+			coreScaling:         float64Ptr(2),
+			expectedMemory:      245760,
+			expectedCore:        300,
+			expectedMemoryRatio: 300,
+		},
+		{
+			name:                "memory oversubscription",
+			scaleRegistered:     true,
+			memoryScaling:       float64Ptr(1.5),
+			expectedMemory:      368640, // 81920 * 1.5 * 3
+			expectedCore:        300,
+			expectedMemoryRatio: 300,
+		},
+		{
+			name:                "core scaling",
+			scaleRegistered:     true,
+			coreScaling:         float64Ptr(2),
+			expectedMemory:      245760,
+			expectedCore:        600,
+			expectedMemoryRatio: 300,
+		},
+		{
+			name:                "memory scaling below one",
+			scaleRegistered:     true,
+			memoryScaling:       float64Ptr(0.5),
+			coreScaling:         float64Ptr(0.5),
+			expectedMemory:      122880,
+			expectedCore:        150,
+			expectedMemoryRatio: 300,
+		},
+		{
+			name:                "memory scaling with memory factor",
+			scaleRegistered:     true,
+			memoryScaling:       float64Ptr(2),
+			memoryFactor:        1024,
+			expectedMemory:      480, // 81920 * 2 * 3 / 1024
+			expectedCore:        300,
+			expectedMemoryRatio: 300,
+		},
+	}
+	for _, tc := range scalingCases {
+		t.Run(tc.name, func(t *testing.T) {
+			scaledConfig := config
+			scaledConfig.ScaleRegisteredDevices = tc.scaleRegistered
+			scaledConfig.DeviceMemoryScaling = tc.memoryScaling
+			scaledConfig.DeviceCoreScaling = tc.coreScaling
+			scaledConfig.MemoryFactor = tc.memoryFactor
+			result := InitNvidiaDevice(scaledConfig).GetResource(&node)
+
+			if result["gpu-memory"] != tc.expectedMemory {
+				t.Errorf("expected total memory %d, got %d", tc.expectedMemory, result["gpu-memory"])
+			}
+			if result["gpu-core"] != tc.expectedCore {
+				t.Errorf("expected total core %d, got %d", tc.expectedCore, result["gpu-core"])
+			}
+			if result["gpu-memory-percentage"] != tc.expectedMemoryRatio {
+				t.Errorf("expected total memory percentage %d, got %d", tc.expectedMemoryRatio, result["gpu-memory-percentage"])
+			}
+		})
+	}
 }
 
 func TestGetNodeDevices(t *testing.T) {
@@ -200,3 +370,256 @@ func TestGetNodeDevices(t *testing.T) {
 		})
 	}
 }
+
+func TestGetResourceNodeConfig(t *testing.T) {
+	float64Ptr := func(f float64) *float64 { return &f }
+	int32Ptr := func(i int32) *int32 { return &i }
+	uintPtr := func(u uint) *uint { return &u }
+
+	config := NvidiaConfig{
+		ResourceCountName:            "nvidia.com/gpu",
+		ResourceMemoryName:           "nvidia.com/gpu-memory",
+		ResourceCoreName:             "nvidia.com/gpu-core",
+		ResourceMemoryPercentageName: "nvidia.com/gpu-memory-percentage",
+		ScaleRegisteredDevices:       true,
+		NodeConfigs: []NodeConfig{
+			{
+				Name:              "node-scaled",
+				NodeDefaultConfig: NodeDefaultConfig{DeviceMemoryScaling: float64Ptr(2)},
+			},
+			{
+				NodeSelector:      map[string]string{"gpu-pool": "oversold"},
+				NodeDefaultConfig: NodeDefaultConfig{DeviceCoreScaling: float64Ptr(3)},
+				MemoryFactor:      int32Ptr(1024),
+			},
+			{
+				Name:              "node-both",
+				NodeSelector:      map[string]string{"gpu-pool": "oversold"},
+				NodeDefaultConfig: NodeDefaultConfig{DeviceMemoryScaling: float64Ptr(1.5)},
+			},
+			{
+				Name:              "node-split",
+				NodeDefaultConfig: NodeDefaultConfig{DeviceSplitCount: uintPtr(20)},
+			},
+			{
+				// Entries without a name or selector never match.
+				NodeDefaultConfig: NodeDefaultConfig{DeviceMemoryScaling: float64Ptr(10)},
+			},
+		},
+	}
+	dev := InitNvidiaDevice(config)
+
+	tests := []struct {
+		name           string
+		nodeName       string
+		labels         map[string]string
+		expectedMemory int
+		expectedCore   int
+	}{
+		{
+			name:           "no matching entry",
+			nodeName:       "node-plain",
+			expectedMemory: 163840,
+			expectedCore:   200,
+		},
+		{
+			name:           "matched by name",
+			nodeName:       "node-scaled",
+			expectedMemory: 327680,
+			expectedCore:   200,
+		},
+		{
+			name:           "matched by label selector",
+			nodeName:       "node-plain",
+			labels:         map[string]string{"gpu-pool": "oversold"},
+			expectedMemory: 160, // 163840 / 1024
+			expectedCore:   600,
+		},
+		{
+			name:           "name without matching labels",
+			nodeName:       "node-both",
+			labels:         map[string]string{"gpu-pool": "standard"},
+			expectedMemory: 163840,
+			expectedCore:   200,
+		},
+		{
+			name:           "later entries override earlier ones",
+			nodeName:       "node-both",
+			labels:         map[string]string{"gpu-pool": "oversold"},
+			expectedMemory: 240, // 163840 * 1.5 / 1024
+			expectedCore:   600,
+		},
+		{
+			name:           "split count does not affect the totals",
+			nodeName:       "node-split",
+			expectedMemory: 163840,
+			expectedCore:   200,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   tt.nodeName,
+					Labels: tt.labels,
+					Annotations: map[string]string{
+						RegisterAnnos: `[
+						{"id":"GPU-0","index":0,"count":10,"devmem":81920,"devcore":100,"type":"NVIDIA A100-SXM4-80GB","mode":"hami-core","health":true},
+						{"id":"GPU-1","index":1,"count":10,"devmem":81920,"devcore":100,"type":"NVIDIA A100-SXM4-80GB","mode":"hami-core","health":true}
+						]`,
+					},
+				},
+				Status: corev1.NodeStatus{
+					Capacity: corev1.ResourceList{
+						corev1.ResourceName(config.ResourceCountName): resource.MustParse("20"),
+					},
+				},
+			}
+
+			result := dev.GetResource(&node)
+			if result["gpu-memory"] != tt.expectedMemory {
+				t.Errorf("expected total memory %d, got %d", tt.expectedMemory, result["gpu-memory"])
+			}
+			if result["gpu-core"] != tt.expectedCore {
+				t.Errorf("expected total core %d, got %d", tt.expectedCore, result["gpu-core"])
+			}
+		})
+	}
+}
+
+func TestGetResourceMigProfiles(t *testing.T) {
+	config := NvidiaConfig{
+		ResourceCountName:  "nvidia.com/gpu",
+		ResourceMemoryName: "nvidia.com/gpumem",
+		ResourceCoreName:   "nvidia.com/gpucores",
+		MigGeometriesList: []AllowedMigGeometries{
+			{
+				Models: []string{"A100-SXM4-40GB"},
+				Geometries: []device.Geometry{
+					{{Name: "1g.5gb", Memory: 5120, Count: 7}},
+					{{Name: "2g.10gb", Memory: 10240, Count: 3}},
+					{{Name: "3g.20gb", Memory: 20480, Count: 2}},
+					{{Name: "7g.40gb", Memory: 40960, Count: 1}},
+				},
+			},
+		},
+	}
+	node := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test-node-mig",
+			Annotations: map[string]string{
+				RegisterAnnos: `[
+				{"id":"GPU-0","index":0,"count":10,"devmem":40960,"devcore":100,"type":"NVIDIA A100-SXM4-40GB","mode":"mig","health":true},
+				{"id":"GPU-1","index":1,"count":10,"devmem":40960,"devcore":100,"type":"NVIDIA A100-SXM4-40GB","mode":"mig","health":true},
+				{"id":"GPU-2","index":2,"count":10,"devmem":40960,"devcore":100,"type":"NVIDIA A100-SXM4-40GB","mode":"hami-core","health":true}
+				]`,
+			},
+		},
+		Status: corev1.NodeStatus{
+			Capacity: corev1.ResourceList{
+				corev1.ResourceName(config.ResourceCountName): resource.MustParse("30"),
+			},
+		},
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		result := InitNvidiaDevice(config).GetResource(&node)
+		for name := range result {
+			if strings.HasPrefix(name, MigProfilePrefix) {
+				t.Errorf("unexpected MIG profile resource %s", name)
+			}
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		migConfig := config
+		migConfig.AdvertiseMigProfiles = true
+		result := InitNvidiaDevice(migConfig).GetResource(&node)
+
+		// 3g.20gb x2 and 7g.40gb x1 both carve 40960, the former has more instances.
+		if result["mig-3g.20gb"] != 4 {
+			t.Errorf("expected 4 mig-3g.20gb, got %d", result["mig-3g.20gb"])
+		}
+		for _, name := range []string{"mig-1g.5gb", "mig-2g.10gb", "mig-7g.40gb"} {
+			if _, ok := result[name]; ok {
+				t.Errorf("unexpected resource %s", name)
+			}
+		}
+		if result["gpumem"] != 122880 {
+			t.Errorf("expected total memory %d, got %d", 122880, result["gpumem"])
+		}
+	})
+
+	t.Run("resource names", func(t *testing.T) {
+		migConfig := config
+		migConfig.AdvertiseMigProfiles = true
+		names := InitNvidiaDevice(migConfig).ResourceNames()
+		expected := []string{
+			"nvidia.com/gpumem", "nvidia.com/gpucores",
+			"nvidia.com/mig-1g.5gb", "nvidia.com/mig-2g.10gb", "nvidia.com/mig-3g.20gb", "nvidia.com/mig-7g.40gb",
+		}
+		if strings.Join(names, ",") != strings.Join(expected, ",") {
+			t.Errorf("expected resource names %v, got %v", expected, names)
+		}
+	})
+}
+
+func TestGetResourcePerType(t *testing.T) {
+	config := NvidiaConfig{
+		ResourceCountName:            "nvidia.com/gpu",
+		ResourceMemoryName:           "nvidia.com/gpumem",
+		ResourceCoreName:             "nvidia.com/gpucores",
+		ResourceMemoryPercentageName: "nvidia.com/gpumem-percentage",
+		AdvertisePerTypeResources:    true,
+		MemoryFactor:                 2,
+	}
+	node := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test-node-mixed",
+			Annotations: map[string]string{
+				RegisterAnnos: `GPU-0,10,81920,100,NVIDIA-NVIDIA A100-SXM4-80GB,0,true,0,hami-core:GPU-1,10,81920,100,NVIDIA-NVIDIA A100-SXM4-80GB,0,true,1,hami-core:GPU-2,10,23028,100,NVIDIA-NVIDIA A10,0,true,2,hami-core:`,
+			},
+		},
+		Status: corev1.NodeStatus{
+			Capacity: corev1.ResourceList{
+				corev1.ResourceName(config.ResourceCountName): resource.MustParse("30"),
+			},
+		},
+	}
+
+	result := InitNvidiaDevice(config).GetResource(&node)
+	expected := map[string]int{
+		"gpumem":                  93434, // (81920 * 2 + 23028) / 2
+		"gpucores":                300,
+		"gpumem-percentage":       300,
+		"gpumem-A100-SXM4-80GB":   81920,
+		"gpucores-A100-SXM4-80GB": 200,
+		"gpumem-A10":              11514,
+		"gpucores-A10":            100,
+	}
+	if len(result) != len(expected) {
+		t.Errorf("expected %d resources, got %v", len(expected), result)
+	}
+	for name, want := range expected {
+		if result[name] != want {
+			t.Errorf("expected %s to be %d, got %d", name, want, result[name])
+		}
+	}
+}
+
+func TestModelName(t *testing.T) {
+	tests := map[string]string{
+		"NVIDIA A100-SXM4-80GB":        "A100-SXM4-80GB",
+		"NVIDIA-NVIDIA A100-SXM4-80GB": "A100-SXM4-80GB",
+		"NVIDIA-Tesla P4":              "Tesla P4",
+		"Tesla T4":                     "Tesla T4",
+		"NVIDIAN":                      "NVIDIAN",
+		"NVIDIA":                       "",
+	}
+	for deviceType, want := range tests {
+		if got := modelName(deviceType); got != want {
+			t.Errorf("modelName(%q) = %q, want %q", deviceType, got, want)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HAMi/mock-device-plugin/internal/pkg/api/device"
+	"github.com/HAMi/mock-device-plugin/internal/pkg/api/device/ascend"
+	"github.com/HAMi/mock-device-plugin/internal/pkg/api/device/hygon"
+	"github.com/HAMi/mock-device-plugin/internal/pkg/api/device/nvidia"
+	"github.com/HAMi/mock-device-plugin/internal/pkg/mock/fakekubelet"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Test_PluginEndToEnd runs the managers of several vendors at once, from the register
+// annotations of a node to the devices kubelet sees through ListAndWatch, allocates
+// one of each and shuts them down through the context.
+func Test_PluginEndToEnd(t *testing.T) {
+	kubelet, err := fakekubelet.Start(t.TempDir())
+	assert.NilError(t, err)
+	defer kubelet.Stop()
+
+	testCases := []struct {
+		name        string
+		dev         device.Devices
+		annotations map[string]string
+		countName   string
+		expected    map[string]int
+	}{
+		{
+			name: "nvidia",
+			dev: nvidia.InitNvidiaDevice(nvidia.NvidiaConfig{
+				ResourceCountName:            "nvidia.com/gpu",
+				ResourceMemoryName:           "nvidia.com/gpumem",
+				ResourceCoreName:             "nvidia.com/gpucores",
+				ResourceMemoryPercentageName: "nvidia.com/gpumem-percentage",
+			}),
+			annotations: map[string]string{
+				nvidia.RegisterAnnos: `[
+				{"id":"GPU-0","index":0,"count":10,"devmem":1024,"devcore":100,"type":"NVIDIA A100","health":true},
+				{"id":"GPU-1","index":1,"count":10,"devmem":1024,"devcore":100,"type":"NVIDIA A100","health":true}
+				]`,
+			},
+			countName: "nvidia.com/gpu",
+			expected: map[string]int{
+				"nvidia.com/gpumem":            2048,
+				"nvidia.com/gpucores":          200,
+				"nvidia.com/gpumem-percentage": 200,
+			},
+		},
+		{
+			name: "hygon",
+			dev: hygon.InitDCUDevice(hygon.HygonConfig{
+				ResourceCountName:  "hygon.com/dcunum",
+				ResourceMemoryName: "hygon.com/dcumem",
+				ResourceCoreName:   "hygon.com/dcucores",
+			}),
+			annotations: map[string]string{
+				hygon.RegisterAnnos: `[
+				{"id":"DCU-0","index":0,"count":4,"devmem":512,"devcore":100,"type":"DCU-K100_AI","health":true},
+				{"id":"DCU-1","index":1,"count":4,"devmem":512,"devcore":60,"type":"DCU-K100_AI","health":true}
+				]`,
+			},
+			countName: "hygon.com/dcunum",
+			expected: map[string]int{
+				"hygon.com/dcumem":   1024,
+				"hygon.com/dcucores": 160,
+			},
+		},
+		{
+			name: "ascend",
+			dev: ascend.InitDevices([]ascend.VNPUConfig{{
+				CommonWord:         "Ascend310P",
+				ResourceName:       "huawei.com/Ascend310P",
+				ResourceMemoryName: "huawei.com/Ascend310P-memory",
+				MemoryFactor:       1,
+			}})[0],
+			annotations: map[string]string{
+				"hami.io/node-register-Ascend310P": `[{"id":"id1","devmem":1024,"health":true},{"id":"id2","devmem":1024,"health":true}]`,
+			},
+			countName: "huawei.com/Ascend310P",
+			expected: map[string]int{
+				"huawei.com/Ascend310P-memory": 2048,
+			},
+		},
+	}
+
+	t.Setenv("NODE_NAME", "node")
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node", Annotations: map[string]string{}},
+		Status:     corev1.NodeStatus{Capacity: corev1.ResourceList{}},
+	}
+	savedDevices := device.DevicesMap
+	defer func() {
+		device.DevicesMap = savedDevices
+		device.ResetShutdown()
+	}()
+	device.DevicesMap = map[string]device.Devices{}
+	expected := map[string]int{}
+	for _, tc := range testCases {
+		device.DevicesMap[tc.dev.CommonWord()] = tc.dev
+		for key, value := range tc.annotations {
+			node.Annotations[key] = value
+		}
+		node.Status.Capacity[corev1.ResourceName(tc.countName)] = resource.MustParse("2")
+		for name, count := range tc.expected {
+			expected[name] = count
+		}
+	}
+	kubeClient := fake.NewSimpleClientset(node)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	result := make(chan error)
+	go func() {
+		result <- device.RunManagers(ctx, kubeClient, device.ManagerOptions{
+			ShutdownTimeout:  30 * time.Second,
+			DevicePluginPath: kubelet.Dir(),
+		})
+	}()
+
+	for name, count := range expected {
+		assert.NilError(t, kubelet.WaitForDevices(ctx, name, count), name)
+	}
+	for name := range expected {
+		devs := kubelet.Devices(name)
+		resp, err := kubelet.Allocate(ctx, name, devs[0].ID)
+		assert.NilError(t, err, name)
+		assert.Equal(t, len(resp.ContainerResponses), 1, name)
+	}
+	for _, tc := range testCases {
+		assert.Assert(t, device.GetLister(tc.dev.CommonWord()).Registered(), tc.name)
+	}
+	device.GetLister(nvidia.NvidiaGPUDevice).SetOverride("gpumem", 8, time.Hour)
+	assert.NilError(t, kubelet.WaitForDevices(ctx, "nvidia.com/gpumem", 8))
+
+	cancel()
+	assert.NilError(t, <-result, "the managers stop before the shutdown timeout")
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer waitCancel()
+	assert.NilError(t, kubelet.WaitForResources(waitCtx), "every plugin stopped")
+	for name := range expected {
+		socket := filepath.Join(kubelet.Dir(), strings.Replace(name, "/", "_", 1))
+		_, err := os.Stat(socket)
+		assert.Assert(t, os.IsNotExist(err), "socket %s is removed", socket)
+	}
+}
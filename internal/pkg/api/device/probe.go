@@ -0,0 +1,120 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// HeartbeatTimeout is how long a Register loop may go without running before the
+// process is considered stuck.
+const HeartbeatTimeout = 3 * SyncInterval
+
+// VendorState is the per-vendor view served by the probes and the detail view.
+type VendorState struct {
+	Vendor string `json:"vendor"`
+	Status
+	// Running is true once the dpm manager of the vendor started.
+	Running bool `json:"running"`
+	// Registered is true once kubelet opened a ListAndWatch stream to the vendor.
+	Registered bool `json:"registered"`
+	// Ready is true once the vendor synced and registered, or has nothing to advertise.
+	Ready bool `json:"ready"`
+	// Reason explains why the vendor is not ready.
+	Reason string `json:"reason,omitempty"`
+}
+
+// VendorStates returns the state of every initialized device serving resources,
+// sorted by vendor.
+func VendorStates() []VendorState {
+	var states []VendorState
+	for vendor, dev := range DevicesMap {
+		if len(dev.ResourceNames()) == 0 {
+			continue
+		}
+		state := VendorState{Vendor: vendor, Status: GetStatus(vendor)}
+		if l := GetLister(vendor); l != nil {
+			state.Running = true
+			state.Registered = l.Registered()
+		}
+		state.Reason = state.notReadyReason()
+		state.Ready = state.Reason == ""
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Vendor < states[j].Vendor
+	})
+	return states
+}
+
+func (s VendorState) notReadyReason() string {
+	switch {
+	case !s.Running:
+		return "manager not running"
+	case s.LastSync.IsZero():
+		return "no successful sync yet"
+	case !s.Registered && s.advertises():
+		return "not registered with kubelet"
+	}
+	return ""
+}
+
+// advertises reports whether the last sync found anything to advertise. dpm only
+// starts plugins, and kubelet only connects, for resources with a non-zero count.
+func (s VendorState) advertises() bool {
+	for _, val := range s.Advertised {
+		if val > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckLive fails when the Register loop of a vendor stopped running.
+func CheckLive(now time.Time) error {
+	var errs []error
+	for _, state := range VendorStates() {
+		if state.LastHeartbeat.IsZero() {
+			continue
+		}
+		if age := now.Sub(state.LastHeartbeat); age > HeartbeatTimeout {
+			errs = append(errs, fmt.Errorf("%s: register loop last ran %s ago", state.Vendor, age.Round(time.Second)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CheckReady fails until every vendor is ready, see VendorState.Ready.
+func CheckReady() error {
+	if shuttingDown.Load() {
+		return errors.New("shutting down")
+	}
+	states := VendorStates()
+	if len(states) == 0 {
+		return errors.New("no devices configured")
+	}
+	var errs []error
+	for _, state := range states {
+		if !state.Ready {
+			errs = append(errs, fmt.Errorf("%s: %s", state.Vendor, state.Reason))
+		}
+	}
+	return errors.Join(errs...)
+}
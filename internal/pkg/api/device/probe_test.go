@@ -0,0 +1,107 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/HAMi/mock-device-plugin/internal/pkg/mock"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	kubeletdevicepluginv1beta1 "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+type fakeDevices struct {
+	commonWord string
+}
+
+func (d fakeDevices) CommonWord() string { return d.commonWord }
+func (d fakeDevices) GetNodeDevices(n *corev1.Node) ([]*DeviceInfo, error) {
+	return nil, nil
+}
+func (d fakeDevices) GetResource(n *corev1.Node) map[string]int { return nil }
+func (d fakeDevices) ResourceNames() []string {
+	return []string{"vendor.com/" + d.commonWord + "-memory"}
+}
+
+// openStream accepts every Send until ctx is cancelled.
+type openStream struct {
+	kubeletdevicepluginv1beta1.DevicePlugin_ListAndWatchServer
+	ctx context.Context
+}
+
+func (s openStream) Send(*kubeletdevicepluginv1beta1.ListAndWatchResponse) error { return nil }
+func (s openStream) Context() context.Context                                    { return s.ctx }
+
+func Test_CheckReady(t *testing.T) {
+	savedDevices, savedStatuses := DevicesMap, statuses
+	defer func() {
+		DevicesMap, statuses = savedDevices, savedStatuses
+		listers = map[string]*mock.MockLister{}
+	}()
+	DevicesMap = map[string]Devices{"a": fakeDevices{"a"}, "b": fakeDevices{"b"}}
+	statuses = map[string]*Status{}
+	listers = map[string]*mock.MockLister{}
+
+	assert.ErrorContains(t, CheckReady(), "a: manager not running")
+
+	listerA, listerB := mock.NewMockLister(context.Background(), "vendor.com"), mock.NewMockLister(context.Background(), "vendor.com")
+	listers["a"], listers["b"] = listerA, listerB
+	assert.ErrorContains(t, CheckReady(), "b: no successful sync yet")
+
+	recordSync("a", "vendor.com", map[string]int{"a-memory": 1024}, nil)
+	recordSync("b", "vendor.com", map[string]int{"b-memory": 0}, nil)
+	assert.ErrorContains(t, CheckReady(), "a: not registered with kubelet")
+
+	plugin := listerA.NewPlugin("a-memory").(*mock.MockPlugin)
+	ctx, cancel := context.WithCancel(context.Background())
+	streamDone := make(chan error)
+	go func() {
+		streamDone <- plugin.ListAndWatch(&kubeletdevicepluginv1beta1.Empty{}, openStream{ctx: ctx})
+	}()
+	for !plugin.Registered() {
+		time.Sleep(time.Millisecond)
+	}
+	assert.NilError(t, CheckReady(), "b advertises nothing and does not need to register")
+
+	states := VendorStates()
+	assert.Equal(t, len(states), 2)
+	assert.Equal(t, states[0].Vendor, "a")
+	assert.Assert(t, states[0].Registered && states[0].Ready)
+	assert.DeepEqual(t, states[0].Advertised, map[string]int{"vendor.com/a-memory": 1024})
+
+	cancel()
+	assert.NilError(t, <-streamDone)
+	assert.ErrorContains(t, CheckReady(), "a: not registered with kubelet", "the stream ended, e.g. on a kubelet restart")
+}
+
+func Test_CheckLive(t *testing.T) {
+	savedDevices, savedStatuses := DevicesMap, statuses
+	defer func() { DevicesMap, statuses = savedDevices, savedStatuses }()
+	DevicesMap = map[string]Devices{"a": fakeDevices{"a"}}
+	statuses = map[string]*Status{}
+
+	now := time.Now()
+	assert.NilError(t, CheckLive(now), "a loop that has not run yet is still starting")
+	updateStatus("a", func(status *Status) { status.LastHeartbeat = now.Add(-SyncInterval) })
+	assert.NilError(t, CheckLive(now))
+	updateStatus("a", func(status *Status) { status.LastHeartbeat = now.Add(-2 * HeartbeatTimeout) })
+	assert.ErrorContains(t, CheckLive(now), "a: register loop last ran")
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// ReservedAnnos publishes the headroom every vendor keeps back on the node, e.g.
+// {"NVIDIA":{"memory":4096,"cores":20}}.
+const ReservedAnnos = "hami.io/mock-reserved"
+
+// Reservation keeps part of every device away from HAMi-scheduled pods, e.g. for
+// DCGM or monitoring sidecars. Each value is either an absolute amount in the unit
+// of the register annotation ("1024") or a percentage of the device ("10%").
+type Reservation struct {
+	Memory string `yaml:"memory"`
+	Cores  string `yaml:"cores"`
+}
+
+// ReservedTotals sums what a Reservation kept back over the devices of a vendor.
+type ReservedTotals struct {
+	Memory int64 `json:"memory"`
+	Cores  int64 `json:"cores"`
+}
+
+// IsZero reports whether nothing is reserved.
+func (r Reservation) IsZero() bool {
+	return r.Memory == "" && r.Cores == ""
+}
+
+// Validate checks that both values parse.
+func (r Reservation) Validate() error {
+	if _, err := reservedAmount(r.Memory, 0); err != nil {
+		return fmt.Errorf("reserved memory: %w", err)
+	}
+	if _, err := reservedAmount(r.Cores, 0); err != nil {
+		return fmt.Errorf("reserved cores: %w", err)
+	}
+	return nil
+}
+
+// ReservedMemory returns how much of a device with total memory is reserved.
+func (r Reservation) ReservedMemory(total int64) int64 {
+	amount, _ := reservedAmount(r.Memory, total)
+	return amount
+}
+
+// ReservedCores returns how many of a device's total cores are reserved.
+func (r Reservation) ReservedCores(total int64) int64 {
+	amount, _ := reservedAmount(r.Cores, total)
+	return amount
+}
+
+// reservedAmount parses value against total, never reserving more than total nor
+// less than zero, which a malformed register annotation can make total.
+func reservedAmount(value string, total int64) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	var amount int64
+	if percent, found := strings.CutSuffix(value, "%"); found {
+		p, err := strconv.ParseFloat(percent, 64)
+		if err != nil || p < 0 || p > 100 {
+			return 0, fmt.Errorf("invalid percentage %q", value)
+		}
+		amount = int64(float64(total) * p / 100)
+	} else {
+		a, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || a < 0 {
+			return 0, fmt.Errorf("invalid amount %q", value)
+		}
+		amount = a
+	}
+	return max(0, min(amount, total)), nil
+}
+
+// ReserveDevices returns copies of devs with the reservation taken off their memory
+// and cores, and records the reserved totals in the vendor status.
+func ReserveDevices(vendor string, r Reservation, devs []*DeviceInfo) []*DeviceInfo {
+	if r.IsZero() {
+		RecordReserved(vendor, nil)
+		return devs
+	}
+	reserved := make([]*DeviceInfo, 0, len(devs))
+	totals := ReservedTotals{}
+	for _, val := range devs {
+		memory := r.ReservedMemory(int64(val.Devmem))
+		cores := r.ReservedCores(int64(val.Devcore))
+		dev := *val
+		dev.Devmem -= int32(memory)
+		dev.Devcore -= int32(cores)
+		reserved = append(reserved, &dev)
+		totals.Memory += memory
+		totals.Cores += cores
+	}
+	RecordReserved(vendor, &totals)
+	return reserved
+}
+
+// RecordReserved records the reserved totals of vendor, nil when nothing is reserved.
+func RecordReserved(vendor string, totals *ReservedTotals) {
+	if totals != nil {
+		klog.InfoS("Reserve resources", "vendor", vendor, "memory", totals.Memory, "cores", totals.Cores)
+	}
+	updateStatus(vendor, func(status *Status) {
+		status.Reserved = totals
+	})
+}
+
+// ReservedAnnotation returns the ReservedAnnos value for every vendor that reserves
+// resources, or "" when none does.
+func ReservedAnnotation() (string, error) {
+	statusMutex.Lock()
+	reserved := map[string]*ReservedTotals{}
+	for vendor, status := range statuses {
+		if status.Reserved != nil {
+			totals := *status.Reserved
+			reserved[vendor] = &totals
+		}
+	}
+	statusMutex.Unlock()
+	if len(reserved) == 0 {
+		return "", nil
+	}
+	value, err := json.Marshal(reserved)
+	return string(value), err
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"context"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_reservedAmount(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		total   int64
+		want    int64
+		wantErr bool
+	}{
+		{name: "empty", value: "", total: 1000, want: 0},
+		{name: "absolute", value: "1024", total: 81920, want: 1024},
+		{name: "percentage", value: "10%", total: 81920, want: 8192},
+		{name: "fractional percentage", value: "2.5%", total: 100, want: 2},
+		{name: "clamped to total", value: "2048", total: 1024, want: 1024},
+		{name: "negative total", value: "2048", total: -1024, want: 0},
+		{name: "percentage of negative total", value: "10%", total: -1024, want: 0},
+		{name: "negative", value: "-1", wantErr: true},
+		{name: "percentage above 100", value: "101%", wantErr: true},
+		{name: "not a number", value: "1Gi", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reservedAmount(tt.value, tt.total)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("reservedAmount() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("reservedAmount() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ReserveDevices(t *testing.T) {
+	devs := []*DeviceInfo{
+		{ID: "GPU-0", Devmem: 81920, Devcore: 100},
+		{ID: "GPU-1", Devmem: 40960, Devcore: 100},
+	}
+	reserved := ReserveDevices("test", Reservation{Memory: "1024", Cores: "10%"}, devs)
+	assert.Equal(t, reserved[0].Devmem, int32(80896))
+	assert.Equal(t, reserved[0].Devcore, int32(90))
+	assert.Equal(t, reserved[1].Devmem, int32(39936))
+	assert.Equal(t, devs[0].Devmem, int32(81920), "the decoded devices must not be modified")
+	assert.DeepEqual(t, GetStatus("test").Reserved, &ReservedTotals{Memory: 2048, Cores: 20})
+
+	ReserveDevices("test", Reservation{}, devs)
+	assert.Assert(t, GetStatus("test").Reserved == nil)
+}
+
+func Test_publishAnnotations(t *testing.T) {
+	statusMutex.Lock()
+	statuses = map[string]*Status{}
+	statusMutex.Unlock()
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}}
+	kubeClient := fake.NewSimpleClientset(node)
+
+	getAnnotation := func() (string, bool) {
+		n, err := kubeClient.CoreV1().Nodes().Get(context.Background(), "node", metav1.GetOptions{})
+		assert.NilError(t, err)
+		value, ok := n.Annotations[ReservedAnnos]
+		return value, ok
+	}
+
+	assert.NilError(t, publishAnnotations(context.Background(), kubeClient, node))
+	_, ok := getAnnotation()
+	assert.Assert(t, !ok, "nothing reserved, nothing published")
+
+	RecordReserved("NVIDIA", &ReservedTotals{Memory: 4096, Cores: 20})
+	RecordReserved("DCU", &ReservedTotals{Memory: 1024})
+	assert.NilError(t, publishAnnotations(context.Background(), kubeClient, node))
+	value, _ := getAnnotation()
+	assert.Equal(t, value, `{"DCU":{"memory":1024,"cores":0},"NVIDIA":{"memory":4096,"cores":20}}`)
+
+	RecordReserved("NVIDIA", nil)
+	RecordReserved("DCU", nil)
+	node, _ = kubeClient.CoreV1().Nodes().Get(context.Background(), "node", metav1.GetOptions{})
+	assert.NilError(t, publishAnnotations(context.Background(), kubeClient, node))
+	_, ok = getAnnotation()
+	assert.Assert(t, !ok, "annotation is removed once nothing is reserved")
+}
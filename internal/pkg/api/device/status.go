@@ -0,0 +1,163 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// ExcludedDevicesAnnos lists devices an operator took out of service on a node, e.g.
+// "GPU-0b1f...,3,NVIDIA:1". See IsExcluded for the accepted entries.
+const ExcludedDevicesAnnos = "hami.io/mock-excluded-devices"
+
+// Status records what a vendor observed during its last GetResource pass, so that
+// the manager loop and diagnostics can report it without decoding the node again.
+type Status struct {
+	// UnhealthyReason explains why the node failed its health check, empty when healthy.
+	UnhealthyReason string `json:"unhealthyReason,omitempty"`
+	// HandshakeError explains why the handshake annotation could not be parsed, in
+	// which case the handshake source does not check it.
+	HandshakeError string `json:"handshakeError,omitempty"`
+	// UnhealthyDevices lists the IDs of devices HAMi marked unhealthy.
+	UnhealthyDevices []string `json:"unhealthyDevices,omitempty"`
+	// ExcludedDevices lists the IDs of devices left out by the exclusion list.
+	ExcludedDevices []string `json:"excludedDevices,omitempty"`
+	// Reserved sums the headroom kept back by the vendor reservation.
+	Reserved *ReservedTotals `json:"reserved,omitempty"`
+	// Devices is the device list last decoded from the register annotation.
+	Devices []*DeviceInfo `json:"devices,omitempty"`
+	// MemoryFactor is the factor memory resources were divided by.
+	MemoryFactor int32 `json:"memoryFactor,omitempty"`
+	// Advertised is the resource map last served to kubelet, by full resource name.
+	Advertised map[string]int `json:"advertised,omitempty"`
+	// Overridden lists the resources of Advertised served with an admin API override
+	// instead of their computed value.
+	Overridden []string `json:"overridden,omitempty"`
+	// LastSync is when GetResource last completed against a fetched node.
+	LastSync time.Time `json:"lastSync"`
+	// SyncState is SyncStateOK, SyncStateStale or SyncStateExpired, empty before the
+	// first successful sync.
+	SyncState string `json:"syncState,omitempty"`
+	// ConsecutiveFailures counts the failed node fetches since the last successful sync.
+	ConsecutiveFailures int `json:"consecutiveFailures,omitempty"`
+	// LastHeartbeat is when the Register loop of the vendor last ran.
+	LastHeartbeat time.Time `json:"lastHeartbeat"`
+}
+
+var (
+	statusMutex sync.Mutex
+	statuses    = map[string]*Status{}
+
+	// excludedDevices are the configured exclusions applied on every node.
+	excludedDevices []string
+)
+
+// SetExcludedDevices sets the exclusions applied on every node in addition to the
+// ExcludedDevicesAnnos annotation.
+func SetExcludedDevices(entries []string) {
+	excludedDevices = entries
+}
+
+// updateStatus applies update to the status of vendor under the status lock.
+func updateStatus(vendor string, update func(*Status)) {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+	status, ok := statuses[vendor]
+	if !ok {
+		status = &Status{}
+		statuses[vendor] = status
+	}
+	update(status)
+}
+
+// GetStatus returns a copy of the status last recorded for vendor.
+func GetStatus(vendor string) Status {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+	if status, ok := statuses[vendor]; ok {
+		return *status
+	}
+	return Status{}
+}
+
+// UsableDevices returns the devices whose resources may be advertised. Devices HAMi
+// marked unhealthy in the register annotation and devices on the exclusion list are
+// left out, logged and recorded in the vendor status.
+func UsableDevices(n *corev1.Node, vendor string, devs []*DeviceInfo) []*DeviceInfo {
+	entries := append(ParseExcludedDevices(n.Annotations[ExcludedDevicesAnnos]), excludedDevices...)
+	usable := make([]*DeviceInfo, 0, len(devs))
+	var unhealthy, excluded []string
+	for _, val := range devs {
+		if IsExcluded(entries, vendor, val) {
+			excluded = append(excluded, val.ID)
+			continue
+		}
+		if !val.Health {
+			unhealthy = append(unhealthy, val.ID)
+			continue
+		}
+		usable = append(usable, val)
+	}
+	if len(excluded) > 0 {
+		klog.InfoS("Skip excluded devices", "vendor", vendor, "count", len(excluded), "devices", excluded)
+	}
+	if len(unhealthy) > 0 {
+		klog.InfoS("Skip unhealthy devices", "vendor", vendor, "count", len(unhealthy), "devices", unhealthy)
+	}
+	updateStatus(vendor, func(status *Status) {
+		status.Devices = devs
+		status.UnhealthyDevices = unhealthy
+		status.ExcludedDevices = excluded
+	})
+	return usable
+}
+
+// ParseExcludedDevices splits a comma separated exclusion list, dropping blanks.
+func ParseExcludedDevices(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// IsExcluded reports whether dev of vendor matches one of entries. An entry is a
+// device ID or index, optionally qualified with the vendor common word as
+// "<commonWord>:<id or index>" to tell apart indices of different vendors. An index
+// only matches devices whose register annotation carries one.
+func IsExcluded(entries []string, vendor string, dev *DeviceInfo) bool {
+	for _, entry := range entries {
+		if owner, id, found := strings.Cut(entry, ":"); found {
+			if owner != vendor {
+				continue
+			}
+			entry = id
+		}
+		if entry == dev.ID || (dev.HasIndex && entry == strconv.FormatUint(uint64(dev.Index), 10)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_UsableDevices(t *testing.T) {
+	devs := []*DeviceInfo{
+		{ID: "GPU-0", Index: 0, HasIndex: true, Health: true},
+		{ID: "GPU-1", Index: 1, HasIndex: true, Health: false},
+		{ID: "GPU-2", Index: 2, HasIndex: true, Health: true},
+		{ID: "GPU-3", Index: 3, HasIndex: true, Health: true},
+	}
+	tests := []struct {
+		name         string
+		annotation   string
+		configured   []string
+		wantUsable   []string
+		wantExcluded []string
+	}{
+		{
+			name:       "no exclusions",
+			wantUsable: []string{"GPU-0", "GPU-2", "GPU-3"},
+		},
+		{
+			name:         "excluded by id and index",
+			annotation:   "GPU-0, 3",
+			wantUsable:   []string{"GPU-2"},
+			wantExcluded: []string{"GPU-0", "GPU-3"},
+		},
+		{
+			name:         "excluded by config",
+			configured:   []string{"GPU-2"},
+			wantUsable:   []string{"GPU-0", "GPU-3"},
+			wantExcluded: []string{"GPU-2"},
+		},
+		{
+			name:         "qualified entries only match their vendor",
+			annotation:   "DCU:0,test:2",
+			wantUsable:   []string{"GPU-0", "GPU-3"},
+			wantExcluded: []string{"GPU-2"},
+		},
+	}
+	defer SetExcludedDevices(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetExcludedDevices(tt.configured)
+			n := &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{ExcludedDevicesAnnos: tt.annotation},
+			}}
+			var usable []string
+			for _, dev := range UsableDevices(n, "test", devs) {
+				usable = append(usable, dev.ID)
+			}
+			assert.DeepEqual(t, usable, tt.wantUsable)
+			status := GetStatus("test")
+			assert.DeepEqual(t, status.ExcludedDevices, tt.wantExcluded)
+			assert.DeepEqual(t, status.UnhealthyDevices, []string{"GPU-1"})
+		})
+	}
+}
+
+func Test_IsExcluded_jsonIndex(t *testing.T) {
+	tests := []struct {
+		name       string
+		annotation string
+		entries    []string
+		want       []string
+	}{
+		{
+			name:       "omitted index is 0",
+			annotation: `[{"id":"GPU-0","devmem":81920,"health":true}]`,
+			entries:    []string{"test:0"},
+			want:       []string{"GPU-0"},
+		},
+		{
+			name:       "omitted index is 0 when other records have one",
+			annotation: `[{"id":"GPU-0","health":true},{"id":"GPU-1","index":1,"health":true}]`,
+			entries:    []string{"0"},
+			want:       []string{"GPU-0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			devs, err := UnMarshalNodeDevices(tt.annotation)
+			assert.NilError(t, err)
+			var excluded []string
+			for _, dev := range devs {
+				if IsExcluded(tt.entries, "test", dev) {
+					excluded = append(excluded, dev.ID)
+				}
+			}
+			assert.DeepEqual(t, excluded, tt.want)
+		})
+	}
+}
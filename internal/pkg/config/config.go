@@ -17,11 +17,16 @@ limitations under the License.
 package config
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"os"
+	"sort"
+	"time"
 
 	"gopkg.in/yaml.v2"
 	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 
 	"github.com/HAMi/mock-device-plugin/internal/pkg/api/device"
 	"github.com/HAMi/mock-device-plugin/internal/pkg/api/device/amd"
@@ -49,10 +54,35 @@ type Config struct {
 	AWSNeuronConfig awsneuron.AWSNeuronConfig `yaml:"awsneuron"`
 	AMDGPUConfig    amd.AMDConfig             `yaml:"amd"`
 	VNPUs           []ascend.VNPUConfig       `yaml:"vnpus"`
+	NodeConfig      []nvidia.NodeConfig       `yaml:"nodeconfig"`
+	Health          device.HealthConfig       `yaml:"health"`
+	ExcludedDevices []string                  `yaml:"excludedDevices"`
+	StrictDecoding  bool                      `yaml:"strictDecoding"`
 }
 
 var (
 	configFile string
+
+	// MetricsBindAddress is where /metrics is served, empty to disable it.
+	MetricsBindAddress string
+	// HealthProbeBindAddress is where /healthz, /readyz and /statusz are served,
+	// empty to disable them.
+	HealthProbeBindAddress string
+	// AdminBindAddress is where the admin API is served, empty to disable it.
+	AdminBindAddress string
+	// ShutdownTimeout bounds how long the managers may take to stop on SIGTERM.
+	ShutdownTimeout time.Duration
+	// MaxStaleness bounds how long the last known good totals are advertised while
+	// the node cannot be fetched, zero to advertise them indefinitely.
+	MaxStaleness time.Duration
+	// DevicePluginPath is the kubelet device plugin directory, holding the kubelet
+	// socket and the plugin sockets.
+	DevicePluginPath string
+	// Kubeconfig is the kubeconfig file to connect with, empty to look it up.
+	Kubeconfig string
+	// KubeAPIQPS and KubeAPIBurst limit the requests sent to the API server.
+	KubeAPIQPS   float64
+	KubeAPIBurst int
 )
 
 func LoadConfig(path string) (*Config, error) {
@@ -70,16 +100,30 @@ func LoadConfig(path string) (*Config, error) {
 	return &yamlData, nil
 }
 
+// configuredDevice remembers which section of the config file a device was built
+// from, so that conflicts can be reported in terms the operator can act on.
+type configuredDevice struct {
+	section string
+	dev     device.Devices
+}
+
 func InitDevicesWithConfig(config *Config) error {
-	device.DevicesMap = make(map[string]device.Devices)
+	if err := device.InitHealthPolicy(config.Health); err != nil {
+		return err
+	}
+	device.SetExcludedDevices(config.ExcludedDevices)
+	device.SetStrictDecoding(config.StrictDecoding)
+	if err := validateReservations(config); err != nil {
+		return err
+	}
+	var devs []configuredDevice
 	/*amdDevice := amd.InitAMDDevice(config.AMDGPUConfig)
 	if amdDevice != nil {
 		device.DevicesMap[amdDevice.CommonWord()] = amdDevice
 	}*/
-	for _, dev := range ascend.InitDevices(config.VNPUs) {
-		commonWord := dev.CommonWord()
-		device.DevicesMap[commonWord] = dev
-		klog.Infof("Ascend device %s initialized", commonWord)
+	for i, dev := range ascend.InitDevices(config.VNPUs) {
+		devs = append(devs, configuredDevice{section: fmt.Sprintf("vnpus[%d]", i), dev: dev})
+		klog.Infof("Ascend device %s initialized", dev.CommonWord())
 	}
 	/*awsNeuronDevice := awsneuron.InitAWSNeuronDevice(config.AWSNeuronConfig)
 	if awsNeuronDevice != nil {
@@ -99,15 +143,85 @@ func InitDevicesWithConfig(config *Config) error {
 	}*/
 	hygonDevice := hygon.InitDCUDevice(config.HygonConfig)
 	if hygonDevice != nil {
-		device.DevicesMap[hygonDevice.CommonWord()] = hygonDevice
+		devs = append(devs, configuredDevice{section: "hygon", dev: hygonDevice})
 	}
+	config.NvidiaConfig.NodeConfigs = config.NodeConfig
 	nvidiaDevice := nvidia.InitNvidiaDevice(config.NvidiaConfig)
 	if nvidiaDevice != nil {
-		device.DevicesMap[nvidiaDevice.CommonWord()] = nvidiaDevice
+		devs = append(devs, configuredDevice{section: "nvidia", dev: nvidiaDevice})
+	}
+	resourceOwners, err := buildResourceOwners(devs)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(resourceOwners))
+	for name := range resourceOwners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		klog.Infof("Resource %s is served by %s", name, resourceOwners[name])
+	}
+	device.DevicesMap = make(map[string]device.Devices)
+	for _, d := range devs {
+		device.DevicesMap[d.dev.CommonWord()] = d.dev
 	}
 	return nil
 }
 
+// validateReservations checks the reserved headroom of every vendor section.
+func validateReservations(config *Config) error {
+	var errs []error
+	for i, vnpu := range config.VNPUs {
+		if err := vnpu.Reserved.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("vnpus[%d]: %w", i, err))
+		}
+	}
+	if err := config.HygonConfig.Reserved.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("hygon: %w", err))
+	}
+	if err := config.NvidiaConfig.Reserved.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("nvidia: %w", err))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid reservation: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// buildResourceOwners maps every resource name advertised by devs to the common word
+// of the device serving it. Two dpm managers serving the same resource would fight
+// over the same kubelet socket, so a resource or common word claimed twice is an error.
+func buildResourceOwners(devs []configuredDevice) (map[string]string, error) {
+	owners := make(map[string]configuredDevice)
+	commonWords := make(map[string]configuredDevice)
+	var errs []error
+	for _, d := range devs {
+		commonWord := d.dev.CommonWord()
+		if prev, ok := commonWords[commonWord]; ok {
+			errs = append(errs, fmt.Errorf("common word %q is used by both %s and %s", commonWord, prev.section, d.section))
+		} else {
+			commonWords[commonWord] = d
+		}
+		for _, name := range d.dev.ResourceNames() {
+			if prev, ok := owners[name]; ok {
+				errs = append(errs, fmt.Errorf("resource %q is claimed by both %s (%s) and %s (%s)",
+					name, prev.section, prev.dev.CommonWord(), d.section, commonWord))
+				continue
+			}
+			owners[name] = d
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("conflicting device configuration: %w", errors.Join(errs...))
+	}
+	resourceOwners := make(map[string]string, len(owners))
+	for name, d := range owners {
+		resourceOwners[name] = d.dev.CommonWord()
+	}
+	return resourceOwners, nil
+}
+
 func InitDevices() {
 	if len(device.DevicesMap) > 0 {
 		klog.Info("Devices are already initialized, skipping initialization")
@@ -127,4 +241,13 @@ func InitDevices() {
 
 func GlobalFlagSet() {
 	flag.StringVar(&configFile, "device-config-file", "", "Path to the device config file")
+	flag.StringVar(&MetricsBindAddress, "metrics-bind-address", ":9396", "Address to serve Prometheus metrics on, empty to disable")
+	flag.StringVar(&HealthProbeBindAddress, "health-probe-bind-address", ":9397", "Address to serve health probes on, empty to disable")
+	flag.StringVar(&AdminBindAddress, "admin-bind-address", "127.0.0.1:9398", "Address to serve the admin API on, empty to disable")
+	flag.DurationVar(&ShutdownTimeout, "shutdown-timeout", 10*time.Second, "How long to wait for the managers to stop their plugins on shutdown")
+	flag.DurationVar(&MaxStaleness, "max-staleness", 0, "How long to keep advertising the last known good totals while the node cannot be fetched before advertising zero, 0 to never expire them")
+	flag.StringVar(&DevicePluginPath, "device-plugin-path", pluginapi.DevicePluginPath, "Kubelet device plugin directory to serve the plugins in")
+	flag.StringVar(&Kubeconfig, "kubeconfig", "", "Path to a kubeconfig file, defaults to KUBECONFIG, ~/.kube/config or the in-cluster config")
+	flag.Float64Var(&KubeAPIQPS, "kube-api-qps", 5, "Queries per second allowed to the Kubernetes API server")
+	flag.IntVar(&KubeAPIBurst, "kube-api-burst", 10, "Burst of queries allowed to the Kubernetes API server")
 }
@@ -0,0 +1,148 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/HAMi/mock-device-plugin/internal/pkg/api/device"
+	"github.com/HAMi/mock-device-plugin/internal/pkg/api/device/ascend"
+	"github.com/HAMi/mock-device-plugin/internal/pkg/api/device/hygon"
+	"github.com/HAMi/mock-device-plugin/internal/pkg/api/device/nvidia"
+)
+
+func TestInitDevicesWithConfig(t *testing.T) {
+	nvidiaConfig := nvidia.NvidiaConfig{
+		ResourceCountName:            "nvidia.com/gpu",
+		ResourceMemoryName:           "nvidia.com/gpumem",
+		ResourceCoreName:             "nvidia.com/gpucores",
+		ResourceMemoryPercentageName: "nvidia.com/gpumem-percentage",
+	}
+	hygonConfig := hygon.HygonConfig{
+		ResourceCountName:  "hygon.com/dcunum",
+		ResourceMemoryName: "hygon.com/dcumem",
+	}
+	ascend910B := ascend.VNPUConfig{
+		CommonWord:         "Ascend910B",
+		ResourceName:       "huawei.com/Ascend910B",
+		ResourceMemoryName: "huawei.com/Ascend910B-memory",
+	}
+	ascend310P := ascend.VNPUConfig{
+		CommonWord:         "Ascend310P",
+		ResourceName:       "huawei.com/Ascend310P",
+		ResourceMemoryName: "huawei.com/Ascend310P-memory",
+	}
+
+	tests := []struct {
+		name        string
+		config      Config
+		wantErr     []string
+		wantDevices []string
+	}{
+		{
+			name: "no conflicts",
+			config: Config{
+				NvidiaConfig: nvidiaConfig,
+				HygonConfig:  hygonConfig,
+				VNPUs:        []ascend.VNPUConfig{ascend910B, ascend310P},
+			},
+			wantDevices: []string{"NVIDIA", "DCU", "Ascend910B", "Ascend310P"},
+		},
+		{
+			name: "two vnpus share a memory resource",
+			config: Config{
+				NvidiaConfig: nvidiaConfig,
+				VNPUs: []ascend.VNPUConfig{ascend910B, func() ascend.VNPUConfig {
+					c := ascend310P
+					c.ResourceMemoryName = ascend910B.ResourceMemoryName
+					return c
+				}()},
+			},
+			wantErr: []string{`resource "huawei.com/Ascend910B-memory" is claimed by both vnpus[0] (Ascend910B) and vnpus[1] (Ascend310P)`},
+		},
+		{
+			name: "two vnpus share a common word",
+			config: Config{
+				VNPUs: []ascend.VNPUConfig{ascend910B, ascend910B},
+			},
+			wantErr: []string{
+				`common word "Ascend910B" is used by both vnpus[0] and vnpus[1]`,
+				`resource "huawei.com/Ascend910B-memory" is claimed by both vnpus[0] (Ascend910B) and vnpus[1] (Ascend910B)`,
+			},
+		},
+		{
+			name: "hygon and nvidia resolve to the same resource",
+			config: Config{
+				NvidiaConfig: nvidiaConfig,
+				HygonConfig: hygon.HygonConfig{
+					ResourceCountName:  "hygon.com/dcunum",
+					ResourceMemoryName: "nvidia.com/gpumem",
+				},
+			},
+			wantErr: []string{`resource "nvidia.com/gpumem" is claimed by both hygon (DCU) and nvidia (NVIDIA)`},
+		},
+		{
+			name: "unknown health source",
+			config: Config{
+				NvidiaConfig: nvidiaConfig,
+				Health:       device.HealthConfig{Sources: []string{"dcgm"}},
+			},
+			wantErr: []string{`unknown health source "dcgm"`},
+		},
+		{
+			name: "invalid reservation",
+			config: Config{
+				NvidiaConfig: func() nvidia.NvidiaConfig {
+					c := nvidiaConfig
+					c.Reserved = device.Reservation{Memory: "120%"}
+					return c
+				}(),
+			},
+			wantErr: []string{`nvidia: reserved memory: invalid percentage "120%"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device.DevicesMap = nil
+			err := InitDevicesWithConfig(&tt.config)
+			if len(tt.wantErr) > 0 {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				for _, want := range tt.wantErr {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("expected error to contain %q, got %q", want, err.Error())
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(device.DevicesMap) != len(tt.wantDevices) {
+				t.Errorf("expected %d devices, got %d", len(tt.wantDevices), len(device.DevicesMap))
+			}
+			for _, commonWord := range tt.wantDevices {
+				if _, ok := device.DevicesMap[commonWord]; !ok {
+					t.Errorf("expected device %s to be initialized", commonWord)
+				}
+			}
+		})
+	}
+}
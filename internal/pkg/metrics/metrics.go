@@ -0,0 +1,108 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics exposes what the mock device plugin advertised and how its sync
+// with the node went as Prometheus series. Metric names and labels are part of the
+// plugin's interface and must stay stable.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "hami_mock_device_plugin"
+
+var (
+	// Registry holds every series of the plugin, plus the Go and process collectors.
+	Registry = prometheus.NewRegistry()
+
+	AdvertisedResources = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "advertised_resources",
+		Help:      "Amount of each resource last advertised to kubelet.",
+	}, []string{"vendor", "resource"})
+	OverriddenResources = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "overridden_resources",
+		Help:      "1 when the advertised amount of a resource is overridden through the admin API.",
+	}, []string{"vendor", "resource"})
+	NodeFetchErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "node_fetch_errors_total",
+		Help:      "Number of failed attempts to get the node from the API server.",
+	}, []string{"vendor"})
+	DecodeFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "annotation_decode_failures_total",
+		Help:      "Number of register annotations that could not be decoded.",
+	}, []string{"vendor"})
+	UnhealthyDevices = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "unhealthy_devices",
+		Help:      "Number of devices HAMi marked unhealthy at the last sync of a vendor.",
+	}, []string{"vendor"})
+	LastSyncTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_sync_timestamp_seconds",
+		Help:      "Unix time of the last successful sync of a vendor with the node.",
+	}, []string{"vendor"})
+	SyncState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sync_state",
+		Help:      "1 for the current sync state of a vendor: ok, stale (serving the last known good totals) or expired (advertising zero).",
+	}, []string{"vendor", "state"})
+	ConsecutiveSyncFailures = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "consecutive_sync_failures",
+		Help:      "Number of failed attempts to get the node since the last successful sync of a vendor.",
+	}, []string{"vendor"})
+	ListAndWatchStreams = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "list_and_watch_streams",
+		Help:      "Number of open ListAndWatch streams from kubelet.",
+	}, []string{"resource"})
+	AllocateRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "allocate_requests_total",
+		Help:      "Number of Allocate calls received from kubelet.",
+	}, []string{"resource"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		AdvertisedResources,
+		OverriddenResources,
+		NodeFetchErrors,
+		DecodeFailures,
+		UnhealthyDevices,
+		LastSyncTimestamp,
+		SyncState,
+		ConsecutiveSyncFailures,
+		ListAndWatchStreams,
+		AllocateRequests,
+	)
+}
+
+// Handler serves the series of Registry.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	AdvertisedResources.WithLabelValues("NVIDIA", "nvidia.com/gpumem").Set(245760)
+	OverriddenResources.WithLabelValues("NVIDIA", "nvidia.com/gpumem").Set(1)
+	NodeFetchErrors.WithLabelValues("NVIDIA").Inc()
+	DecodeFailures.WithLabelValues("NVIDIA").Inc()
+	UnhealthyDevices.WithLabelValues("NVIDIA").Set(2)
+	LastSyncTimestamp.WithLabelValues("NVIDIA").Set(1700000000)
+	ListAndWatchStreams.WithLabelValues("nvidia.com/gpumem").Inc()
+	AllocateRequests.WithLabelValues("nvidia.com/gpumem").Inc()
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(recorder.Body)
+	if err != nil {
+		t.Fatalf("failed to read metrics: %v", err)
+	}
+
+	// The names and labels below are scraped by dashboards and alerts, changing
+	// them is a breaking change.
+	for _, want := range []string{
+		`hami_mock_device_plugin_advertised_resources{resource="nvidia.com/gpumem",vendor="NVIDIA"} 245760`,
+		`hami_mock_device_plugin_overridden_resources{resource="nvidia.com/gpumem",vendor="NVIDIA"} 1`,
+		`hami_mock_device_plugin_node_fetch_errors_total{vendor="NVIDIA"} 1`,
+		`hami_mock_device_plugin_annotation_decode_failures_total{vendor="NVIDIA"} 1`,
+		`hami_mock_device_plugin_unhealthy_devices{vendor="NVIDIA"} 2`,
+		`hami_mock_device_plugin_last_sync_timestamp_seconds{vendor="NVIDIA"} 1.7e+09`,
+		`hami_mock_device_plugin_list_and_watch_streams{resource="nvidia.com/gpumem"} 1`,
+		`hami_mock_device_plugin_allocate_requests_total{resource="nvidia.com/gpumem"} 1`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("expected metrics to contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fakekubelet stands in for the kubelet device manager in tests. Kubelet
+// serves the Registration service on a socket in a directory of the test, connects
+// back to the plugins registering with it, consumes their ListAndWatch streams and
+// issues Allocate calls.
+package fakekubelet
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// KubeletSocket is the name of the Registration socket in the kubelet directory.
+const KubeletSocket = "kubelet.sock"
+
+// Kubelet is a fake kubelet device manager.
+type Kubelet struct {
+	dir    string
+	server *grpc.Server
+
+	mutex     sync.Mutex
+	resources map[string]*endpoint
+	// updated is closed and replaced whenever a device list changes.
+	updated chan struct{}
+}
+
+// endpoint is a registered plugin and the last device list it sent.
+type endpoint struct {
+	conn    *grpc.ClientConn
+	client  pluginapi.DevicePluginClient
+	cancel  context.CancelFunc
+	devices []*pluginapi.Device
+}
+
+// Start serves the Registration service on KubeletSocket in dir.
+func Start(dir string) (*Kubelet, error) {
+	socket := filepath.Join(dir, KubeletSocket)
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	lis, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	k := &Kubelet{
+		dir:       dir,
+		server:    grpc.NewServer(),
+		resources: map[string]*endpoint{},
+		updated:   make(chan struct{}),
+	}
+	pluginapi.RegisterRegistrationServer(k.server, k)
+	go func() {
+		if err := k.server.Serve(lis); err != nil {
+			klog.ErrorS(err, "Fake kubelet stopped serving")
+		}
+	}()
+	return k, nil
+}
+
+// Dir returns the directory of the kubelet and plugin sockets.
+func (k *Kubelet) Dir() string {
+	return k.dir
+}
+
+// Socket returns the path of the Registration socket.
+func (k *Kubelet) Socket() string {
+	return filepath.Join(k.dir, KubeletSocket)
+}
+
+// Register connects to the plugin endpoint and starts consuming its ListAndWatch
+// stream. A plugin registering a resource again replaces the previous one.
+func (k *Kubelet) Register(ctx context.Context, req *pluginapi.RegisterRequest) (*pluginapi.Empty, error) {
+	if req.Version != pluginapi.Version {
+		return nil, fmt.Errorf("unsupported device plugin API version %q", req.Version)
+	}
+	conn, err := dial(filepath.Join(k.dir, req.Endpoint))
+	if err != nil {
+		return nil, err
+	}
+	client := pluginapi.NewDevicePluginClient(conn)
+	streamCtx, cancel := context.WithCancel(context.Background())
+	stream, err := client.ListAndWatch(streamCtx, &pluginapi.Empty{})
+	if err != nil {
+		cancel()
+		conn.Close()
+		return nil, fmt.Errorf("ListAndWatch %s: %w", req.ResourceName, err)
+	}
+	e := &endpoint{conn: conn, client: client, cancel: cancel}
+	k.mutex.Lock()
+	if prev, ok := k.resources[req.ResourceName]; ok {
+		prev.close()
+	}
+	k.resources[req.ResourceName] = e
+	k.notifyLocked()
+	k.mutex.Unlock()
+	klog.InfoS("Fake kubelet registered plugin", "resource", req.ResourceName, "endpoint", req.Endpoint)
+
+	go func() {
+		for {
+			resp, err := stream.Recv()
+			k.mutex.Lock()
+			if k.resources[req.ResourceName] != e {
+				k.mutex.Unlock()
+				return
+			}
+			if err != nil {
+				// Like kubelet, forget the devices of a plugin that went away.
+				delete(k.resources, req.ResourceName)
+				e.close()
+			} else {
+				e.devices = resp.Devices
+			}
+			k.notifyLocked()
+			k.mutex.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return &pluginapi.Empty{}, nil
+}
+
+// Resources returns the registered resource names, sorted.
+func (k *Kubelet) Resources() []string {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	names := make([]string, 0, len(k.resources))
+	for name := range k.resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Devices returns the last device list sent for resource, nil if it is not registered.
+func (k *Kubelet) Devices(resource string) []*pluginapi.Device {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if e, ok := k.resources[resource]; ok {
+		return e.devices
+	}
+	return nil
+}
+
+// WaitForDevices blocks until resource is registered with count healthy devices.
+func (k *Kubelet) WaitForDevices(ctx context.Context, resource string, count int) error {
+	for {
+		k.mutex.Lock()
+		e, registered := k.resources[resource]
+		healthy := 0
+		if registered {
+			for _, dev := range e.devices {
+				if dev.Health == pluginapi.Healthy {
+					healthy++
+				}
+			}
+		}
+		updated := k.updated
+		k.mutex.Unlock()
+		if registered && healthy == count {
+			return nil
+		}
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			return fmt.Errorf("%s has %d healthy devices, want %d: %w", resource, healthy, count, ctx.Err())
+		}
+	}
+}
+
+// WaitForResources blocks until exactly resources are registered, e.g. none once
+// every plugin went away.
+func (k *Kubelet) WaitForResources(ctx context.Context, resources ...string) error {
+	want := append([]string(nil), resources...)
+	sort.Strings(want)
+	for {
+		k.mutex.Lock()
+		updated := k.updated
+		k.mutex.Unlock()
+		got := k.Resources()
+		if slices.Equal(got, want) {
+			return nil
+		}
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			return fmt.Errorf("registered resources are %v, want %v: %w", got, want, ctx.Err())
+		}
+	}
+}
+
+// Allocate asks the plugin of resource to allocate deviceIDs to a single container.
+func (k *Kubelet) Allocate(ctx context.Context, resource string, deviceIDs ...string) (*pluginapi.AllocateResponse, error) {
+	k.mutex.Lock()
+	e, ok := k.resources[resource]
+	k.mutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("resource %s is not registered", resource)
+	}
+	return e.client.Allocate(ctx, &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIDs: deviceIDs}},
+	})
+}
+
+// Stop closes the connections to the plugins and stops serving.
+func (k *Kubelet) Stop() {
+	k.mutex.Lock()
+	for name, e := range k.resources {
+		e.close()
+		delete(k.resources, name)
+	}
+	k.notifyLocked()
+	k.mutex.Unlock()
+	k.server.Stop()
+}
+
+func (k *Kubelet) notifyLocked() {
+	close(k.updated)
+	k.updated = make(chan struct{})
+}
+
+func (e *endpoint) close() {
+	e.cancel()
+	e.conn.Close()
+}
+
+// dial connects to the gRPC server on the unix socket at path.
+func dial(path string) (*grpc.ClientConn, error) {
+	return grpc.Dial("unix://"+path, grpc.WithTransportCredentials(insecure.NewCredentials()))
+}
@@ -14,29 +14,61 @@ limitations under the License.
 package mock
 
 import (
+	"context"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/kubevirt/device-plugin-manager/pkg/dpm"
+	"k8s.io/klog/v2"
 )
 
+// Override replaces the computed count of a resource until ExpiresAt.
+type Override struct {
+	Count     int       `json:"count"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	timer     *time.Timer
+}
+
+// PluginState describes one resource of a lister for the admin API.
+type PluginState struct {
+	Resource string `json:"resource"`
+	// Count is the value served to kubelet, the override when one is set.
+	Count int `json:"count"`
+	// Served is true once the manager started a plugin for the resource.
+	Served     bool      `json:"served"`
+	Registered bool      `json:"registered"`
+	Override   *Override `json:"override,omitempty"`
+}
+
 // Lister serves as an interface between imlementation and Manager machinery. User passes
 // implementation of this interface to NewManager function. Manager will use it to obtain resource
 // namespace, monitor available resources and instantate a new plugin for them.
 type MockLister struct {
+	// ctx stops the lister and its plugins when cancelled.
+	ctx context.Context
+	// ResUpdateChan holds the latest resource list not yet picked up by Discover.
 	ResUpdateChan chan dpm.PluginNameList
 	Heartbeat     chan bool
 	Namespace     string
-	counts        map[string]int
-	pluginsMap    map[string]*MockPlugin
-	mutex         sync.Mutex
+	// OnOverrideChange, when set, is called without the lister lock held after an
+	// override was set, cleared or expired, so that what is reported as served can
+	// follow it before the next sync.
+	OnOverrideChange func()
+	counts           map[string]int
+	overrides        map[string]*Override
+	pluginsMap       map[string]*MockPlugin
+	mutex            sync.Mutex
 }
 
-func NewMockLister(namespace string) *MockLister {
+func NewMockLister(ctx context.Context, namespace string) *MockLister {
 	return &MockLister{
-		ResUpdateChan: make(chan dpm.PluginNameList),
+		ctx:           ctx,
+		ResUpdateChan: make(chan dpm.PluginNameList, 1),
 		Heartbeat:     make(chan bool),
 		Namespace:     namespace,
 		counts:        make(map[string]int),
+		overrides:     make(map[string]*Override),
 		pluginsMap:    make(map[string]*MockPlugin),
 	}
 }
@@ -57,10 +89,16 @@ func (l *MockLister) Discover(pluginListCh chan dpm.PluginNameList) {
 	for {
 		select {
 		case newResourcesList := <-l.ResUpdateChan: // New resources found
-			pluginListCh <- newResourcesList
+			select {
+			case pluginListCh <- newResourcesList:
+			case <-l.ctx.Done():
+				return
+			}
 		case <-pluginListCh: // Stop message received
 			// Stop resourceUpdateCh
 			return
+		case <-l.ctx.Done():
+			return
 		}
 	}
 }
@@ -71,14 +109,21 @@ func (l *MockLister) Discover(pluginListCh chan dpm.PluginNameList) {
 func (l *MockLister) NewPlugin(resourceLastName string) dpm.PluginInterface {
 	mockPlugin := MockPlugin{
 		ManagedResource: resourceLastName,
+		ResourceName:    l.Namespace + "/" + resourceLastName,
+		changed:         make(chan struct{}, 1),
+		ctx:             l.ctx,
 	}
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
-	mockPlugin.SetCount(l.counts[resourceLastName])
+	mockPlugin.SetCount(l.countLocked(resourceLastName))
 	l.pluginsMap[resourceLastName] = &mockPlugin
 	return &mockPlugin
 }
 
+// SetResource updates the counts served by the plugins. Resources that are not yet
+// served and have a non-zero count are announced to the manager together with the
+// existing plugins, and plugins missing from resourceMap drop to zero. Overrides take
+// precedence over resourceMap until they expire.
 func (l *MockLister) SetResource(resourceMap map[string]int) {
 	if len(resourceMap) == 0 {
 		return
@@ -86,25 +131,175 @@ func (l *MockLister) SetResource(resourceMap map[string]int) {
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
 	l.counts = resourceMap
-	pluginNums := len(l.pluginsMap)
-
-	if pluginNums == 0 {
-		resourceNames := make([]string, 0, len(resourceMap))
-		hasNoZeroValue := false
-		for name, val := range resourceMap {
-			resourceNames = append(resourceNames, name)
-			if val > 0 {
-				hasNoZeroValue = true
-			}
+	l.syncPluginsLocked()
+}
+
+// HasResource reports whether resource was computed by the last sync or is served
+// by a plugin, i.e. whether it can be overridden.
+func (l *MockLister) HasResource(resource string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	_, computed := l.counts[resource]
+	_, served := l.pluginsMap[resource]
+	return computed || served
+}
+
+// SetOverride serves count for resource instead of the computed value until ttl
+// passes or the override is cleared.
+func (l *MockLister) SetOverride(resource string, count int, ttl time.Duration) Override {
+	l.mutex.Lock()
+	if prev, exists := l.overrides[resource]; exists {
+		prev.timer.Stop()
+	}
+	override := &Override{
+		Count:     count,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	override.timer = time.AfterFunc(ttl, func() {
+		l.mutex.Lock()
+		expired := l.overrides[resource] == override
+		if expired {
+			klog.InfoS("Override expired", "resource", resource, "count", override.Count)
+			delete(l.overrides, resource)
+			l.syncPluginsLocked()
 		}
-		if hasNoZeroValue {
-			l.ResUpdateChan <- resourceNames
+		l.mutex.Unlock()
+		if expired {
+			l.overrideChanged()
 		}
-	} else {
-		for resourceName, val := range resourceMap {
-			if plugin, exists := l.pluginsMap[resourceName]; exists {
-				plugin.SetCount(val)
-			}
+	})
+	l.overrides[resource] = override
+	klog.InfoS("Override resource", "resource", resource, "count", count, "expiresAt", override.ExpiresAt)
+	l.syncPluginsLocked()
+	result := *override
+	l.mutex.Unlock()
+	l.overrideChanged()
+	return result
+}
+
+// ClearOverride drops the override of resource, reporting whether there was one.
+func (l *MockLister) ClearOverride(resource string) bool {
+	l.mutex.Lock()
+	override, exists := l.overrides[resource]
+	if exists {
+		override.timer.Stop()
+		delete(l.overrides, resource)
+		klog.InfoS("Clear override", "resource", resource)
+		l.syncPluginsLocked()
+	}
+	l.mutex.Unlock()
+	if exists {
+		l.overrideChanged()
+	}
+	return exists
+}
+
+func (l *MockLister) overrideChanged() {
+	if l.OnOverrideChange != nil {
+		l.OnOverrideChange()
+	}
+}
+
+// Served returns the counts served to kubelet, i.e. the last computed counts with
+// the overrides applied, and the sorted names of the overridden resources.
+func (l *MockLister) Served() (map[string]int, []string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	served := make(map[string]int, len(l.counts))
+	for name := range l.counts {
+		served[name] = l.countLocked(name)
+	}
+	var overridden []string
+	for name, override := range l.overrides {
+		served[name] = override.Count
+		overridden = append(overridden, name)
+	}
+	sort.Strings(overridden)
+	return served, overridden
+}
+
+// Plugins returns the state of every resource the lister knows about, sorted by name.
+func (l *MockLister) Plugins() []PluginState {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	var states []PluginState
+	for _, name := range l.resourceNamesLocked() {
+		state := PluginState{Resource: name, Count: l.countLocked(name)}
+		if plugin, exists := l.pluginsMap[name]; exists {
+			state.Served = true
+			state.Registered = plugin.Registered()
+		}
+		if override, exists := l.overrides[name]; exists {
+			o := *override
+			state.Override = &o
+		}
+		states = append(states, state)
+	}
+	return states
+}
+
+// countLocked returns the count resource should be served with.
+func (l *MockLister) countLocked(resource string) int {
+	if override, exists := l.overrides[resource]; exists {
+		return override.Count
+	}
+	return l.counts[resource]
+}
+
+// resourceNamesLocked returns the sorted union of computed, overridden and served
+// resources.
+func (l *MockLister) resourceNamesLocked() []string {
+	seen := make(map[string]bool)
+	for name := range l.counts {
+		seen[name] = true
+	}
+	for name := range l.overrides {
+		seen[name] = true
+	}
+	for name := range l.pluginsMap {
+		seen[name] = true
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// syncPluginsLocked pushes the current counts to the plugins and announces the
+// resource list to the manager when a resource without a plugin has a non-zero count.
+// It never waits for the manager, which needs the lock to create the plugins: a list
+// the manager did not pick up yet is replaced, as every list names all resources.
+func (l *MockLister) syncPluginsLocked() {
+	hasNewResource := false
+	names := l.resourceNamesLocked()
+	for _, name := range names {
+		count := l.countLocked(name)
+		if plugin, exists := l.pluginsMap[name]; exists {
+			plugin.SetCount(count)
+		} else if count > 0 {
+			hasNewResource = true
+		}
+	}
+	if hasNewResource {
+		select {
+		case <-l.ResUpdateChan:
+		default:
+		}
+		// Announcements are only sent under the lock, so there is room now.
+		l.ResUpdateChan <- names
+	}
+}
+
+// Registered reports whether kubelet is talking to any plugin of the lister.
+func (l *MockLister) Registered() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, plugin := range l.pluginsMap {
+		if plugin.Registered() {
+			return true
 		}
 	}
+	return false
 }
@@ -0,0 +1,184 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mock
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kubevirt/device-plugin-manager/pkg/dpm"
+	kubeletdevicepluginv1beta1 "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+func TestMockListerOverride(t *testing.T) {
+	l := NewMockLister(context.Background(), "vendor.com")
+	announced := make(chan dpm.PluginNameList, 10)
+	go func() {
+		for names := range l.ResUpdateChan {
+			announced <- names
+		}
+	}()
+
+	l.SetResource(map[string]int{"memory": 1024, "cores": 0})
+	<-announced
+	memory := l.NewPlugin("memory").(*MockPlugin)
+	if !l.HasResource("cores") || l.HasResource("gpus") {
+		t.Errorf("expected only computed resources to be known")
+	}
+	// Expiring overrides are notified from a timer goroutine.
+	var changes atomic.Int32
+	l.OnOverrideChange = func() {
+		if served, _ := l.Served(); len(served) != 2 {
+			t.Errorf("unexpected served counts %v", served)
+		}
+		changes.Add(1)
+	}
+
+	l.SetOverride("memory", 10, time.Hour)
+	if served, overridden := l.Served(); served["memory"] != 10 || len(overridden) != 1 || overridden[0] != "memory" {
+		t.Errorf("expected the override to be reported as served, got %v overridden %v", served, overridden)
+	}
+	if got := memory.GetCount(); got != 10 {
+		t.Errorf("expected the override to be served, got %d", got)
+	}
+	select {
+	case <-memory.changed:
+	default:
+		t.Errorf("expected ListAndWatch to be woken up by the override")
+	}
+	l.SetResource(map[string]int{"memory": 2048, "cores": 0})
+	if got := memory.GetCount(); got != 10 {
+		t.Errorf("expected the override to survive a sync, got %d", got)
+	}
+
+	l.SetOverride("cores", 5, time.Hour)
+	select {
+	case names := <-announced:
+		if len(names) != 2 {
+			t.Errorf("expected both resources to be announced, got %v", names)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected an overridden resource without plugin to be announced")
+	}
+
+	if !l.ClearOverride("memory") {
+		t.Errorf("expected the memory override to be cleared")
+	}
+	if got := memory.GetCount(); got != 2048 {
+		t.Errorf("expected the computed count after clearing, got %d", got)
+	}
+	if l.ClearOverride("memory") {
+		t.Errorf("expected no override left to clear")
+	}
+	if got := changes.Load(); got != 3 {
+		t.Errorf("expected 3 override changes to be notified, got %d", got)
+	}
+
+	l.SetOverride("memory", 1, 10*time.Millisecond)
+	deadline := time.Now().Add(time.Second)
+	for memory.GetCount() != 2048 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := memory.GetCount(); got != 2048 {
+		t.Errorf("expected the override to expire, got %d", got)
+	}
+
+	states := l.Plugins()
+	if len(states) != 2 || states[0].Resource != "cores" || states[0].Override == nil || !states[1].Served {
+		t.Errorf("unexpected plugin states %+v", states)
+	}
+}
+
+func TestMockListerAnnounceWithoutManager(t *testing.T) {
+	l := NewMockLister(context.Background(), "vendor.com")
+	done := make(chan struct{})
+	go func() {
+		l.SetResource(map[string]int{"memory": 1024})
+		l.SetOverride("cores", 5, time.Hour)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected announcements not to wait for the manager")
+	}
+	select {
+	case names := <-l.ResUpdateChan:
+		if len(names) != 2 {
+			t.Errorf("expected the latest list with both resources, got %v", names)
+		}
+	default:
+		t.Errorf("expected the resources to be announced")
+	}
+}
+
+// blockingStream accepts every Send and never ends on its own.
+type blockingStream struct {
+	kubeletdevicepluginv1beta1.DevicePlugin_ListAndWatchServer
+	ctx context.Context
+}
+
+func (s blockingStream) Send(*kubeletdevicepluginv1beta1.ListAndWatchResponse) error { return nil }
+func (s blockingStream) Context() context.Context                                    { return s.ctx }
+
+func TestMockListerShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := NewMockLister(ctx, "vendor.com")
+	plugin := l.NewPlugin("memory").(*MockPlugin)
+
+	listAndWatchDone := make(chan error)
+	go func() {
+		listAndWatchDone <- plugin.ListAndWatch(&kubeletdevicepluginv1beta1.Empty{}, blockingStream{ctx: context.Background()})
+	}()
+	cancel()
+	select {
+	case err := <-listAndWatchDone:
+		if err != nil {
+			t.Errorf("expected ListAndWatch to end cleanly, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected ListAndWatch to end on shutdown")
+	}
+	if plugin.Registered() {
+		t.Errorf("expected the plugin to be unregistered once its stream ended")
+	}
+
+	// Nobody reads the announcements any more, SetResource must not block.
+	setDone := make(chan struct{})
+	go func() {
+		l.SetResource(map[string]int{"memory": 1, "cores": 1})
+		close(setDone)
+	}()
+	select {
+	case <-setDone:
+	case <-time.After(time.Second):
+		t.Fatalf("expected SetResource not to block after shutdown")
+	}
+
+	discoverDone := make(chan struct{})
+	go func() {
+		l.Discover(make(chan dpm.PluginNameList))
+		close(discoverDone)
+	}()
+	select {
+	case <-discoverDone:
+	case <-time.After(time.Second):
+		t.Fatalf("expected Discover to return after shutdown")
+	}
+}
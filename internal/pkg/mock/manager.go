@@ -0,0 +1,257 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mock
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/kubevirt/device-plugin-manager/pkg/dpm"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// Attempts to register a plugin with kubelet, as many as the dpm manager makes.
+const (
+	registerAttempts  = 3
+	registerRetryWait = 3 * time.Second
+	// registerTimeout bounds a single attempt.
+	registerTimeout = 10 * time.Second
+)
+
+// kubeletSocketName is the name of the kubelet Registration socket in the device
+// plugin directory.
+const kubeletSocketName = "kubelet.sock"
+
+// Manager serves the plugins of a mock lister to kubelet the way the dpm manager
+// does: it creates a plugin for every resource Discover lists, serves it on a socket
+// in the device plugin directory and registers it with kubelet, again whenever
+// kubelet restarts. The dpm manager only stops on SIGTERM, SIGQUIT or SIGINT, which
+// it subscribes to itself; Manager stops once the context of the lister is cancelled
+// instead, so that signals stay with the process and vendors stop on their own.
+type Manager struct {
+	lister *MockLister
+	// dir holds the kubelet socket and the plugin sockets.
+	dir     string
+	plugins map[string]*pluginServer
+}
+
+// pluginServer is the gRPC server of a plugin.
+type pluginServer struct {
+	plugin   dpm.PluginInterface
+	resource string
+	socket   string
+	server   *grpc.Server
+}
+
+// NewManager returns the manager of the plugins of l, served in dir, usually
+// pluginapi.DevicePluginPath.
+func NewManager(l *MockLister, dir string) *Manager {
+	return &Manager{
+		lister:  l,
+		dir:     dir,
+		plugins: make(map[string]*pluginServer),
+	}
+}
+
+// Run serves the plugins until the context of the lister is cancelled, then stops
+// them and removes their sockets.
+func (m *Manager) Run() {
+	ctx := m.lister.ctx
+	var kubeletEvents <-chan fsnotify.Event
+	var watchErrors <-chan error
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		defer watcher.Close()
+		err = watcher.Add(m.dir)
+	}
+	if err != nil {
+		klog.ErrorS(err, "Failed to watch for kubelet restarts", "dir", m.dir)
+	} else {
+		kubeletEvents, watchErrors = watcher.Events, watcher.Errors
+	}
+
+	pluginListCh := make(chan dpm.PluginNameList)
+	discovered := make(chan struct{})
+	go func() {
+		defer close(discovered)
+		m.lister.Discover(pluginListCh)
+	}()
+	for {
+		select {
+		case names := <-pluginListCh:
+			m.updatePlugins(ctx, names)
+		case event := <-kubeletEvents:
+			if event.Name == filepath.Join(m.dir, kubeletSocketName) && event.Op&fsnotify.Create != 0 {
+				klog.InfoS("Kubelet restarted, registering the plugins again", "namespace", m.lister.Namespace)
+				m.servePlugins(ctx, m.plugins)
+			}
+		case err := <-watchErrors:
+			klog.ErrorS(err, "Failed to watch for kubelet restarts", "dir", m.dir)
+		case <-ctx.Done():
+			<-discovered
+			for name, p := range m.plugins {
+				p.remove()
+				delete(m.plugins, name)
+			}
+			return
+		}
+	}
+}
+
+// updatePlugins starts a plugin for every new resource of names and stops the plugins
+// of the resources names no longer lists.
+func (m *Manager) updatePlugins(ctx context.Context, names dpm.PluginNameList) {
+	listed := make(map[string]bool, len(names))
+	started := make(map[string]*pluginServer)
+	for _, name := range names {
+		listed[name] = true
+		if _, exists := m.plugins[name]; exists {
+			continue
+		}
+		p := &pluginServer{
+			plugin:   m.lister.NewPlugin(name),
+			resource: m.lister.Namespace + "/" + name,
+			socket:   filepath.Join(m.dir, m.lister.Namespace+"_"+name),
+		}
+		if start, ok := p.plugin.(dpm.PluginInterfaceStart); ok {
+			if err := start.Start(); err != nil {
+				klog.ErrorS(err, "Failed to start plugin", "resource", p.resource)
+				continue
+			}
+		}
+		m.plugins[name] = p
+		started[name] = p
+	}
+	m.servePlugins(ctx, started)
+	for name, p := range m.plugins {
+		if !listed[name] {
+			klog.InfoS("Remove unused plugin", "resource", p.resource)
+			p.remove()
+			delete(m.plugins, name)
+		}
+	}
+}
+
+// servePlugins serves plugins and registers them with kubelet, all at once.
+func (m *Manager) servePlugins(ctx context.Context, plugins map[string]*pluginServer) {
+	kubeletSocket := filepath.Join(m.dir, kubeletSocketName)
+	var wg sync.WaitGroup
+	for _, p := range plugins {
+		wg.Add(1)
+		go func(p *pluginServer) {
+			defer wg.Done()
+			p.serve(ctx, kubeletSocket)
+		}(p)
+	}
+	wg.Wait()
+}
+
+// serve (re)starts the gRPC server of p and registers it with kubelet, retrying a
+// failed registration until ctx is cancelled.
+func (p *pluginServer) serve(ctx context.Context, kubeletSocket string) {
+	for attempt := 1; ; attempt++ {
+		err := p.start(ctx, kubeletSocket)
+		if err == nil {
+			klog.InfoS("Registered plugin with kubelet", "resource", p.resource)
+			return
+		}
+		if attempt == registerAttempts || ctx.Err() != nil {
+			klog.ErrorS(err, "Failed to register plugin with kubelet", "resource", p.resource, "attempts", attempt)
+			return
+		}
+		klog.ErrorS(err, "Failed to register plugin with kubelet, retrying", "resource", p.resource, "retryIn", registerRetryWait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(registerRetryWait):
+		}
+	}
+}
+
+// start serves p on its socket and registers it with kubelet.
+func (p *pluginServer) start(ctx context.Context, kubeletSocket string) error {
+	p.stop()
+	if err := os.Remove(p.socket); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	lis, err := net.Listen("unix", p.socket)
+	if err != nil {
+		return err
+	}
+	p.server = grpc.NewServer()
+	pluginapi.RegisterDevicePluginServer(p.server, p.plugin)
+	go func(server *grpc.Server) {
+		if err := server.Serve(lis); err != nil {
+			klog.ErrorS(err, "Plugin stopped serving", "resource", p.resource)
+		}
+	}(p.server)
+	if err := register(ctx, kubeletSocket, p.resource, filepath.Base(p.socket)); err != nil {
+		p.stop()
+		return err
+	}
+	return nil
+}
+
+// stop stops the gRPC server of p, which ends its ListAndWatch streams, and removes
+// its socket. Stopping a stopped server does nothing.
+func (p *pluginServer) stop() {
+	if p.server == nil {
+		return
+	}
+	p.server.Stop()
+	p.server = nil
+	if err := os.Remove(p.socket); err != nil && !os.IsNotExist(err) {
+		klog.ErrorS(err, "Failed to remove plugin socket", "socket", p.socket)
+	}
+}
+
+// remove stops p for good.
+func (p *pluginServer) remove() {
+	p.stop()
+	if stop, ok := p.plugin.(dpm.PluginInterfaceStop); ok {
+		if err := stop.Stop(); err != nil {
+			klog.ErrorS(err, "Failed to stop plugin", "resource", p.resource)
+		}
+	}
+}
+
+// register registers the plugin serving resource on endpoint, a socket next to
+// kubeletSocket, with kubelet.
+func register(ctx context.Context, kubeletSocket, resource, endpoint string) error {
+	ctx, cancel := context.WithTimeout(ctx, registerTimeout)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, "unix://"+kubeletSocket,
+		grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = pluginapi.NewRegistrationClient(conn).Register(ctx, &pluginapi.RegisterRequest{
+		Version:      pluginapi.Version,
+		Endpoint:     endpoint,
+		ResourceName: resource,
+	})
+	return err
+}
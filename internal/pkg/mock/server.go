@@ -22,6 +22,8 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/HAMi/mock-device-plugin/internal/pkg/metrics"
+
 	"k8s.io/klog/v2"
 	kubeletdevicepluginv1beta1 "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 )
@@ -29,7 +31,15 @@ import (
 // Plugin is identical to DevicePluginServer interface of device plugin API.
 type MockPlugin struct {
 	ManagedResource string
-	count           atomic.Int64
+	// ResourceName is the fully qualified resource name, e.g. nvidia.com/gpumem.
+	ResourceName string
+	count        atomic.Int64
+	// streams counts the open ListAndWatch streams.
+	streams atomic.Int32
+	// changed wakes up ListAndWatch when the count changes.
+	changed chan struct{}
+	// ctx ends ListAndWatch on shutdown, nil for a plugin that is never stopped.
+	ctx context.Context
 }
 
 // Start is an optional interface that could be implemented by plugin.
@@ -76,6 +86,11 @@ func (p *MockPlugin) GetPreferredAllocation(context.Context, *kubeletdeviceplugi
 // Whenever a Device state change or a Device disappears, ListAndWatch
 // returns the new list
 func (p *MockPlugin) ListAndWatch(e *kubeletdevicepluginv1beta1.Empty, s kubeletdevicepluginv1beta1.DevicePlugin_ListAndWatchServer) error {
+	p.streams.Add(1)
+	defer p.streams.Add(-1)
+	streams := metrics.ListAndWatchStreams.WithLabelValues(p.ResourceName)
+	streams.Inc()
+	defer streams.Dec()
 	for {
 		count := p.GetCount()
 		devs := make([]*kubeletdevicepluginv1beta1.Device, count)
@@ -92,8 +107,19 @@ func (p *MockPlugin) ListAndWatch(e *kubeletdevicepluginv1beta1.Empty, s kubelet
 			i++
 		}
 		klog.Infoln("Device Registered", p.ManagedResource, count)
-		s.Send(&kubeletdevicepluginv1beta1.ListAndWatchResponse{Devices: devs})
-		time.Sleep(time.Second * 10)
+		if err := s.Send(&kubeletdevicepluginv1beta1.ListAndWatchResponse{Devices: devs}); err != nil {
+			klog.ErrorS(err, "ListAndWatch stream closed", "resource", p.ResourceName)
+			return err
+		}
+		select {
+		case <-p.changed:
+		case <-time.After(time.Second * 10):
+		case <-s.Context().Done():
+			return nil
+		case <-p.done():
+			klog.InfoS("Stop ListAndWatch on shutdown", "resource", p.ResourceName)
+			return nil
+		}
 	}
 }
 
@@ -102,6 +128,7 @@ func (p *MockPlugin) Allocate(ctx context.Context, reqs *kubeletdevicepluginv1be
 	var car kubeletdevicepluginv1beta1.ContainerAllocateResponse
 
 	klog.Infoln("Into Allocate")
+	metrics.AllocateRequests.WithLabelValues(p.ResourceName).Inc()
 	for range reqs.ContainerRequests {
 		car = kubeletdevicepluginv1beta1.ContainerAllocateResponse{}
 		response.ContainerResponses = append(response.ContainerResponses, &car)
@@ -110,10 +137,32 @@ func (p *MockPlugin) Allocate(ctx context.Context, reqs *kubeletdevicepluginv1be
 	return &response, nil
 }
 
+// done returns the channel closed on shutdown.
+func (p *MockPlugin) done() <-chan struct{} {
+	if p.ctx == nil {
+		return nil
+	}
+	return p.ctx.Done()
+}
+
+// Registered reports whether kubelet has a ListAndWatch stream open, which it only
+// opens once the plugin registered successfully and closes when it restarts.
+func (p *MockPlugin) Registered() bool {
+	return p.streams.Load() > 0
+}
+
 func (p *MockPlugin) GetCount() int {
 	return int(p.count.Load())
 }
 
+// SetCount changes the number of devices served, and sends the new list to kubelet
+// right away when it differs.
 func (p *MockPlugin) SetCount(count int) {
-	p.count.Store(int64(count))
+	if p.count.Swap(int64(count)) == int64(count) {
+		return
+	}
+	select {
+	case p.changed <- struct{}{}:
+	default:
+	}
 }
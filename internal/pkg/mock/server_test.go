@@ -0,0 +1,107 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mock
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/HAMi/mock-device-plugin/internal/pkg/mock/fakekubelet"
+)
+
+func TestMockPluginWithKubelet(t *testing.T) {
+	kubelet, err := fakekubelet.Start(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kubelet.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	l := NewMockLister(ctx, "vendor.com")
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		NewManager(l, kubelet.Dir()).Run()
+	}()
+	// Another vendor keeps serving when the first one stops.
+	otherCtx, otherCancel := context.WithCancel(context.Background())
+	defer otherCancel()
+	other := NewMockLister(otherCtx, "other.com")
+	otherStopped := make(chan struct{})
+	go func() {
+		defer close(otherStopped)
+		NewManager(other, kubelet.Dir()).Run()
+	}()
+	other.SetResource(map[string]int{"memory": 1})
+	if err := kubelet.WaitForDevices(ctx, "other.com/memory", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	l.SetResource(map[string]int{"memory": 4, "cores": 0})
+	if err := kubelet.WaitForDevices(ctx, "vendor.com/memory", 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := kubelet.WaitForDevices(ctx, "vendor.com/cores", 0); err != nil {
+		t.Fatal(err)
+	}
+	if !l.Registered() {
+		t.Errorf("expected the lister to report its plugin registered")
+	}
+
+	l.SetResource(map[string]int{"memory": 2, "cores": 3})
+	if err := kubelet.WaitForDevices(ctx, "vendor.com/memory", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := kubelet.WaitForDevices(ctx, "vendor.com/cores", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	l.SetOverride("memory", 8, time.Hour)
+	if err := kubelet.WaitForDevices(ctx, "vendor.com/memory", 8); err != nil {
+		t.Fatal(err)
+	}
+
+	devs := kubelet.Devices("vendor.com/cores")
+	resp, err := kubelet.Allocate(ctx, "vendor.com/cores", devs[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.ContainerResponses) != 1 {
+		t.Errorf("expected one container response, got %d", len(resp.ContainerResponses))
+	}
+
+	cancel()
+	<-stopped
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer waitCancel()
+	if err := kubelet.WaitForResources(waitCtx, "other.com/memory"); err != nil {
+		t.Errorf("expected only the plugin of the other vendor to be left: %v", err)
+	}
+	otherCancel()
+	<-otherStopped
+	if err := kubelet.WaitForResources(waitCtx); err != nil {
+		t.Errorf("expected every plugin to be stopped: %v", err)
+	}
+	for _, name := range []string{"memory", "cores"} {
+		if _, err := os.Stat(filepath.Join(kubelet.Dir(), "vendor.com_"+name)); !os.IsNotExist(err) {
+			t.Errorf("expected the %s plugin socket to be removed, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/HAMi/mock-device-plugin/internal/pkg/api/device"
+	"github.com/HAMi/mock-device-plugin/internal/pkg/mock"
+
+	"k8s.io/klog/v2"
+)
+
+// DefaultOverrideTTL applies to overrides posted without a ttl.
+const DefaultOverrideTTL = 10 * time.Minute
+
+// getLister looks up the lister of a vendor, replaced by tests.
+var getLister = device.GetLister
+
+// ListerState is what the admin API reports for the lister of one vendor.
+type ListerState struct {
+	Vendor    string             `json:"vendor"`
+	Namespace string             `json:"namespace"`
+	Plugins   []mock.PluginState `json:"plugins"`
+	// Devices is the device list last decoded from the register annotation.
+	Devices []*device.DeviceInfo `json:"devices"`
+}
+
+// OverrideRequest is the body of POST /overrides. Resource is either the full
+// resource name or the part after the vendor namespace, and TTL a Go duration.
+type OverrideRequest struct {
+	Vendor   string `json:"vendor"`
+	Resource string `json:"resource"`
+	Count    int    `json:"count"`
+	TTL      string `json:"ttl"`
+}
+
+// AdminHandler serves the admin API:
+//
+//	GET    /listers                             plugins, counts and decoded devices
+//	POST   /overrides                           serve a fixed count for a while
+//	DELETE /overrides?vendor=...&resource=...   drop an override
+func AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/listers", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, http.StatusOK, listerStates())
+	})
+	mux.HandleFunc("/overrides", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			setOverride(w, r)
+		case http.MethodDelete:
+			clearOverride(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	return mux
+}
+
+func listerStates() []ListerState {
+	states := []ListerState{}
+	for vendor, l := range device.Listers() {
+		states = append(states, ListerState{
+			Vendor:    vendor,
+			Namespace: l.Namespace,
+			Plugins:   l.Plugins(),
+			Devices:   device.GetStatus(vendor).Devices,
+		})
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Vendor < states[j].Vendor
+	})
+	return states
+}
+
+func setOverride(w http.ResponseWriter, r *http.Request) {
+	var req OverrideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid override: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Count < 0 {
+		http.Error(w, "count must not be negative", http.StatusBadRequest)
+		return
+	}
+	ttl := DefaultOverrideTTL
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl <= 0 {
+			http.Error(w, fmt.Sprintf("invalid ttl %q", req.TTL), http.StatusBadRequest)
+			return
+		}
+	}
+	l, resource, err := lookupResource(req.Vendor, req.Resource)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, l.SetOverride(resource, req.Count, ttl))
+}
+
+func clearOverride(w http.ResponseWriter, r *http.Request) {
+	l, resource, err := lookupResource(r.URL.Query().Get("vendor"), r.URL.Query().Get("resource"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if !l.ClearOverride(resource) {
+		http.Error(w, fmt.Sprintf("no override for %s", resource), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lookupResource returns the lister of vendor and the resource name relative to its
+// namespace. Only resources the lister computed or serves can be overridden, so a
+// typo cannot create a new extended resource on the node.
+func lookupResource(vendor, resource string) (*mock.MockLister, string, error) {
+	l := getLister(vendor)
+	if l == nil {
+		return nil, "", fmt.Errorf("no manager running for vendor %q", vendor)
+	}
+	resource = strings.TrimPrefix(resource, l.Namespace+"/")
+	if resource == "" || strings.Contains(resource, "/") || !l.HasResource(resource) {
+		return nil, "", fmt.Errorf("resource %q is not served by %s", resource, l.Namespace)
+	}
+	return l, resource, nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		klog.ErrorS(err, "Failed to encode response")
+	}
+}
+
+// ServeAdmin serves AdminHandler on addr until ctx is cancelled. An empty addr
+// disables it. The admin API is unauthenticated and should only listen on loopback.
+func ServeAdmin(ctx context.Context, addr string) {
+	Serve(ctx, "admin API", addr, AdminHandler())
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/HAMi/mock-device-plugin/internal/pkg/mock"
+)
+
+func TestAdminHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{name: "list", method: "GET", path: "/listers", wantCode: http.StatusOK, wantBody: "[]"},
+		{name: "invalid body", method: "POST", path: "/overrides", body: "{", wantCode: http.StatusBadRequest},
+		{name: "negative count", method: "POST", path: "/overrides", body: `{"vendor":"NVIDIA","resource":"gpumem","count":-1}`, wantCode: http.StatusBadRequest},
+		{name: "invalid ttl", method: "POST", path: "/overrides", body: `{"vendor":"NVIDIA","resource":"gpumem","count":1,"ttl":"soon"}`, wantCode: http.StatusBadRequest},
+		{name: "unknown vendor", method: "POST", path: "/overrides", body: `{"vendor":"NVIDIA","resource":"gpumem","count":1}`, wantCode: http.StatusNotFound, wantBody: `no manager running for vendor "NVIDIA"`},
+		{name: "clear unknown vendor", method: "DELETE", path: "/overrides?vendor=NVIDIA&resource=gpumem", wantCode: http.StatusNotFound},
+		{name: "wrong method", method: "PUT", path: "/overrides", wantCode: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			AdminHandler().ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if recorder.Code != tt.wantCode {
+				t.Errorf("expected status %d, got %d: %s", tt.wantCode, recorder.Code, recorder.Body.String())
+			}
+			if body := recorder.Body.String(); !strings.Contains(body, tt.wantBody) {
+				t.Errorf("expected body to contain %q, got %q", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+func TestAdminHandler_overrides(t *testing.T) {
+	// A stopped lister does not wait for the manager to pick up new resources.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l := mock.NewMockLister(ctx, "nvidia.com")
+	l.SetResource(map[string]int{"gpumem": 1024})
+	saved := getLister
+	defer func() { getLister = saved }()
+	getLister = func(vendor string) *mock.MockLister {
+		if vendor == "NVIDIA" {
+			return l
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{name: "unknown resource", method: "POST", path: "/overrides", body: `{"vendor":"NVIDIA","resource":"nvidia.com/gpumen","count":1}`, wantCode: http.StatusNotFound, wantBody: `resource "gpumen" is not served by nvidia.com`},
+		{name: "other namespace", method: "POST", path: "/overrides", body: `{"vendor":"NVIDIA","resource":"amd.com/gpumem","count":1}`, wantCode: http.StatusNotFound},
+		{name: "override", method: "POST", path: "/overrides", body: `{"vendor":"NVIDIA","resource":"nvidia.com/gpumem","count":4}`, wantCode: http.StatusOK, wantBody: `"count": 4`},
+		{name: "clear unknown resource", method: "DELETE", path: "/overrides?vendor=NVIDIA&resource=gpumen", wantCode: http.StatusNotFound},
+		{name: "clear", method: "DELETE", path: "/overrides?vendor=NVIDIA&resource=gpumem", wantCode: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			AdminHandler().ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if recorder.Code != tt.wantCode {
+				t.Errorf("expected status %d, got %d: %s", tt.wantCode, recorder.Code, recorder.Body.String())
+			}
+			if body := recorder.Body.String(); !strings.Contains(body, tt.wantBody) {
+				t.Errorf("expected body to contain %q, got %q", tt.wantBody, body)
+			}
+		})
+	}
+	if served, overridden := l.Served(); served["gpumem"] != 1024 || len(served) != 1 || overridden != nil {
+		t.Errorf("expected only the computed resource to be served, got %v overridden %v", served, overridden)
+	}
+}
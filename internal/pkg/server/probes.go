@@ -0,0 +1,58 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package server serves the HTTP endpoints used to probe and inspect the plugin.
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/HAMi/mock-device-plugin/internal/pkg/api/device"
+)
+
+// ProbeHandler serves /healthz, /readyz and the per-vendor detail view /statusz.
+func ProbeHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeCheck(w, device.CheckLive(time.Now()))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		writeCheck(w, device.CheckReady())
+	})
+	mux.HandleFunc("/statusz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, device.VendorStates())
+	})
+	return mux
+}
+
+// writeCheck answers a probe with "ok", or 503 and the failures.
+func writeCheck(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// ServeProbes serves ProbeHandler on addr until ctx is cancelled. An empty addr
+// disables it.
+func ServeProbes(ctx context.Context, addr string) {
+	Serve(ctx, "health probes", addr, ProbeHandler())
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/HAMi/mock-device-plugin/internal/pkg/api/device"
+)
+
+func TestProbeHandler(t *testing.T) {
+	device.DevicesMap = nil
+	tests := []struct {
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{path: "/healthz", wantCode: http.StatusOK, wantBody: "ok"},
+		{path: "/readyz", wantCode: http.StatusServiceUnavailable, wantBody: "no devices configured"},
+		{path: "/statusz", wantCode: http.StatusOK, wantBody: "null"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			ProbeHandler().ServeHTTP(recorder, httptest.NewRequest("GET", tt.path, nil))
+			if recorder.Code != tt.wantCode {
+				t.Errorf("expected status %d, got %d", tt.wantCode, recorder.Code)
+			}
+			if body := recorder.Body.String(); !strings.Contains(body, tt.wantBody) {
+				t.Errorf("expected body to contain %q, got %q", tt.wantBody, body)
+			}
+		})
+	}
+}
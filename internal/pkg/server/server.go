@@ -0,0 +1,64 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/HAMi/mock-device-plugin/internal/pkg/metrics"
+
+	"k8s.io/klog/v2"
+)
+
+// shutdownTimeout bounds how long in-flight requests may take once a server stops.
+const shutdownTimeout = 5 * time.Second
+
+// Serve serves handler on addr until ctx is cancelled, then shuts the server down
+// gracefully. An empty addr disables it.
+func Serve(ctx context.Context, name, addr string, handler http.Handler) {
+	if addr == "" {
+		return
+	}
+	srv := &http.Server{Addr: addr, Handler: handler}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			klog.ErrorS(err, "Failed to shut down server", "server", name)
+		}
+	}()
+	klog.InfoS("Serving", "server", name, "address", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		klog.ErrorS(err, "Server stopped", "server", name, "address", addr)
+		return
+	}
+	<-stopped
+}
+
+// ServeMetrics serves /metrics on addr until ctx is cancelled. An empty addr
+// disables it.
+func ServeMetrics(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	Serve(ctx, "metrics", addr, mux)
+}
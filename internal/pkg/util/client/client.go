@@ -17,9 +17,11 @@ limitations under the License.
 package client
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
-	"sync"
+	"runtime"
 
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -27,40 +29,67 @@ import (
 	"k8s.io/klog/v2"
 )
 
-var (
-	kubeClient kubernetes.Interface
-	once       sync.Once
-)
+// Options configure the connection to the API server.
+type Options struct {
+	// Kubeconfig is the kubeconfig file to use. When empty, the file named by
+	// KUBECONFIG or ~/.kube/config is tried before the in-cluster config.
+	Kubeconfig string
+	// QPS and Burst limit the requests sent to the API server, zero for the
+	// client-go defaults.
+	QPS   float32
+	Burst int
+	// UserAgent is sent with every request, empty for the client-go default.
+	UserAgent string
+}
 
-func GetClient() kubernetes.Interface {
-	once.Do(func() {
-		var err error
-		kubeClient, err = NewClient()
-		if err != nil {
-			klog.Errorf("Failed to initialize Kubernetes client: %v", err)
-			panic(err)
-		}
-	})
-	return kubeClient
+// UserAgent returns the user agent of the plugin at version.
+func UserAgent(version string) string {
+	if version == "" {
+		version = "unknown"
+	}
+	return fmt.Sprintf("hami-mock-device-plugin/%s (%s/%s)", version, runtime.GOOS, runtime.GOARCH)
 }
 
 // NewClient connects to an API server.
-func NewClient() (kubernetes.Interface, error) {
-	kubeConfig := os.Getenv("KUBECONFIG")
-	if kubeConfig == "" {
-		kubeConfig = filepath.Join(os.Getenv("HOME"), ".kube", "config")
+func NewClient(opts Options) (kubernetes.Interface, error) {
+	config, err := loadConfig(opts.Kubeconfig)
+	if err != nil {
+		return nil, err
 	}
-	config, err := clientcmd.BuildConfigFromFlags("", kubeConfig)
+	config.QPS = opts.QPS
+	config.Burst = opts.Burst
+	if opts.UserAgent != "" {
+		config.UserAgent = opts.UserAgent
+	}
+	kubeClient, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		klog.Infof("BuildConfigFromFlags failed for file %s: %v using inClusterConfig", kubeConfig, err)
-		config, err = rest.InClusterConfig()
+		return nil, fmt.Errorf("create Kubernetes client: %w", err)
+	}
+	return kubeClient, nil
+}
+
+// loadConfig reads kubeconfig, or finds a config the way NewClient documents when
+// it is empty.
+func loadConfig(kubeconfig string) (*rest.Config, error) {
+	if kubeconfig != "" {
+		config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
 		if err != nil {
-			klog.Errorf("InClusterConfig Failed for err:%s", err.Error())
+			return nil, fmt.Errorf("load kubeconfig %s: %w", kubeconfig, err)
 		}
+		return config, nil
+	}
+	kubeconfig = os.Getenv("KUBECONFIG")
+	if kubeconfig == "" {
+		kubeconfig = filepath.Join(os.Getenv("HOME"), ".kube", "config")
+	}
+	config, fileErr := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if fileErr == nil {
+		return config, nil
 	}
-	KubeClient, err := kubernetes.NewForConfig(config)
+	klog.Infof("BuildConfigFromFlags failed for file %s: %v using inClusterConfig", kubeconfig, fileErr)
+	config, err := rest.InClusterConfig()
 	if err != nil {
-		klog.Errorf("new config error %s", err.Error())
+		return nil, fmt.Errorf("load Kubernetes config: %w", errors.Join(fileErr, err))
 	}
-	return KubeClient, err
+	return config, nil
 }
@@ -0,0 +1,73 @@
+/*
+Copyright 2025 The HAMi Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://127.0.0.1:6443
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+users:
+- name: test
+  user:
+    token: test
+`
+
+func TestNewClient(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(kubeconfig, []byte(testKubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewClient(Options{Kubeconfig: kubeconfig, QPS: 20, Burst: 30, UserAgent: UserAgent("v1.0.0")}); err != nil {
+		t.Errorf("NewClient() with %s: %v", kubeconfig, err)
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing")
+	_, err := NewClient(Options{Kubeconfig: missing})
+	if err == nil || !strings.Contains(err.Error(), missing) {
+		t.Errorf("NewClient() with a missing kubeconfig = %v, want an error naming it", err)
+	}
+
+	t.Setenv("KUBECONFIG", missing)
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	if _, err := NewClient(Options{}); err == nil {
+		t.Error("NewClient() without any config succeeded, want an error")
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	if got := UserAgent("v1.0.0"); !strings.HasPrefix(got, "hami-mock-device-plugin/v1.0.0 (") {
+		t.Errorf("UserAgent(v1.0.0) = %q", got)
+	}
+	if got := UserAgent(""); !strings.HasPrefix(got, "hami-mock-device-plugin/unknown (") {
+		t.Errorf("UserAgent() = %q", got)
+	}
+}